@@ -0,0 +1,77 @@
+// Command benchscan compares the two grid execution paths on a live database: the
+// datagrid_execute_json round-trip and the native typed scan (datagrid.execution
+// "native"). It fetches the same page repeatedly with each and reports time and
+// allocations per fetch.
+//
+//	go run ./cmd/benchscan -catalog internal/data/catalog/personnel.json -limit 100
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/gnemet/datagrid"
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	catalog := flag.String("catalog", "internal/data/catalog/personnel.json", "catalog to fetch")
+	limit := flag.Int("limit", 100, "page size")
+	search := flag.String("search", "", "global search term")
+	flag.Parse()
+
+	// Load shared credentials as baseline, then env-specific overrides
+	_ = godotenv.Load("opt/envs/.env_shared")
+	_ = godotenv.Overload() // .env
+
+	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable search_path=datagrid,public",
+		os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"))
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		slog.Error("Failed to open database", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	h, err := datagrid.NewHandlerFromCatalogContext(ctx, db, *catalog, "en")
+	if err != nil {
+		slog.Error("Failed to load catalog", "error", err)
+		os.Exit(1)
+	}
+	params := datagrid.RequestParams{Search: *search, Limit: *limit}
+
+	for _, mode := range []string{"json", "native"} {
+		h.Config.Execution = mode
+
+		// One fetch up front, so connection setup and errors stay out of the numbers
+		res, err := h.FetchDataContext(ctx, params)
+		if err != nil {
+			slog.Error("Fetch failed", "execution", mode, "error", err)
+			os.Exit(1)
+		}
+
+		r := testing.Benchmark(func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := h.FetchDataContext(ctx, params); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		fmt.Printf("%-7s %4d rows  %s  %s\n", mode, len(res.Records), r.String(), r.MemString())
+		if len(res.Records) > 0 {
+			for k, v := range res.Records[0] {
+				if k != "_json" {
+					fmt.Printf("        %-20s %T\n", k, v)
+				}
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"html/template"
@@ -103,6 +104,17 @@ func main() {
 		os.Exit(1)
 	}
 
+	// SQL statement templates: local overrides (SQL_TEMPLATES_DIR) over the embedded defaults
+	if dir := os.Getenv("SQL_TEMPLATES_DIR"); dir != "" {
+		err = datagrid.RegisterSQLTemplates(os.DirFS(dir))
+	} else {
+		err = datagrid.CheckSQLTemplates()
+	}
+	if err != nil {
+		slog.Error("SQL templates", "error", err)
+		os.Exit(1)
+	}
+
 	// Load templates with helper functions
 	funcMap := datagrid.TemplateFuncs()
 	funcMap["T"] = func(s string) string { return s } // Dummy T function
@@ -139,15 +151,20 @@ func main() {
 		}
 
 		catPath := fmt.Sprintf("internal/data/catalog/%s.json", catParam)
-		gridHandler, err := datagrid.NewHandlerFromCatalog(db, catPath, "en")
+		gridHandler, err := datagrid.NewHandlerFromCatalogContext(r.Context(), db, catPath, "en")
 		if err != nil {
 			http.Error(w, fmt.Sprintf("Failed to load catalog %s: %v", catParam, err), http.StatusInternalServerError)
 			return
 		}
 		gridHandler.LOVChooserThreshold = cfg.Application.LOVChooserThreshold
+		columns, err := gridHandler.ColumnsContext(r.Context())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to resolve columns: %v", err), http.StatusInternalServerError)
+			return
+		}
 
 		hasJsonColumn := false
-		for _, col := range gridHandler.Columns {
+		for _, col := range columns {
 			if strings.Contains(strings.ToLower(col.Type), "json") {
 				hasJsonColumn = true
 				break
@@ -164,7 +181,7 @@ func main() {
 			"ListEndpoint":     "/list",
 			"Limit":            10,
 			"Offset":           0,
-			"UIColumns":        gridHandler.Columns,
+			"UIColumns":        columns,
 			"LangsJSON":        `["en", "hu"]`,
 			"CurrentLang":      "en",
 			"IconStyleLibrary": strings.TrimSpace(gridHandler.IconStyleLibrary),
@@ -176,8 +193,9 @@ func main() {
 			"CurrentCatalog":      catParam,
 			"LOVChooserThreshold": cfg.Application.LOVChooserThreshold,
 			"IsQueryMode":         gridHandler.IsQueryMode,
-			"QueryParams":         gridHandler.QueryParams,
+			"QueryParams":         gridHandler.QueryParamsContext(r.Context()),
 			"ExecuteEndpoint":     "/execute",
+			"OptionsEndpoint":     "/options",
 			"CurrentUser":         "",
 		}
 
@@ -190,7 +208,7 @@ func main() {
 			catParam = "personnel"
 		}
 		catPath := fmt.Sprintf("internal/data/catalog/%s.json", catParam)
-		gridHandler, err := datagrid.NewHandlerFromCatalog(db, catPath, "en")
+		gridHandler, err := datagrid.NewHandlerFromCatalogContext(r.Context(), db, catPath, "en")
 		if err != nil {
 			slog.Error("Error loading catalog", "cat_param", catParam, "error", err)
 			http.Error(w, fmt.Sprintf("Error loading catalog: %v", err), http.StatusInternalServerError)
@@ -199,6 +217,7 @@ func main() {
 		gridHandler.LOVChooserThreshold = cfg.Application.LOVChooserThreshold
 		gridHandler.ListEndpoint = "/list?config=" + catParam
 		gridHandler.PivotEndpoint = "/pivot?config=" + catParam
+		gridHandler.CellEndpoint = "/cell?config=" + catParam
 		gridHandler.AppName = "Personnel Analytics"
 		gridHandler.Catalogs = map[string]string{
 			"personnel":        "Personnel & Payroll",
@@ -207,7 +226,17 @@ func main() {
 			"pivot_multi_test": "Personnel Analytics & Pivot",
 		}
 		params := gridHandler.ParseParams(r)
-		result, err := gridHandler.FetchData(params)
+		result, err := gridHandler.FetchDataContext(r.Context(), params)
+		var terr *datagrid.TimeoutError
+		if errors.As(err, &terr) {
+			tmpl.ExecuteTemplate(w, "datagrid_timeout", terr)
+			return
+		}
+		var ferr *datagrid.FilterError
+		if errors.As(err, &ferr) {
+			tmpl.ExecuteTemplate(w, "datagrid_filter_error", ferr)
+			return
+		}
 		if err != nil {
 			slog.Error("handler error", "error", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -223,7 +252,7 @@ func main() {
 			catParam = "personnel"
 		}
 		catPath := fmt.Sprintf("internal/data/catalog/%s.json", catParam)
-		gridHandler, err := datagrid.NewHandlerFromCatalog(db, catPath, "en")
+		gridHandler, err := datagrid.NewHandlerFromCatalogContext(r.Context(), db, catPath, "en")
 		if err != nil {
 			slog.Error("Error loading catalog", "cat_param", catParam, "error", err)
 			http.Error(w, fmt.Sprintf("Error loading catalog: %v", err), http.StatusInternalServerError)
@@ -240,7 +269,17 @@ func main() {
 			"pivot_multi_test": "Personnel Analytics & Pivot",
 		}
 		params := gridHandler.ParseParams(r)
-		result, err := gridHandler.PivotData(params)
+		result, err := gridHandler.PivotDataContext(r.Context(), params)
+		var terr *datagrid.TimeoutError
+		if errors.As(err, &terr) {
+			tmpl.ExecuteTemplate(w, "datagrid_timeout", terr)
+			return
+		}
+		var ferr *datagrid.FilterError
+		if errors.As(err, &ferr) {
+			tmpl.ExecuteTemplate(w, "datagrid_filter_error", ferr)
+			return
+		}
 		if err != nil {
 			slog.Error("handler error", "error", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -256,7 +295,7 @@ func main() {
 			catParam = "query_demo"
 		}
 		catPath := fmt.Sprintf("internal/data/catalog/%s.json", catParam)
-		gridHandler, err := datagrid.NewHandlerFromCatalog(db, catPath, "en")
+		gridHandler, err := datagrid.NewHandlerFromCatalogContext(r.Context(), db, catPath, "en")
 		if err != nil {
 			slog.Error("Error loading catalog", "cat_param", catParam, "error", err)
 			http.Error(w, fmt.Sprintf("Error loading catalog: %v", err), http.StatusInternalServerError)
@@ -267,7 +306,25 @@ func main() {
 		gridHandler.ExecuteEndpoint = "/execute?config=" + catParam
 		gridHandler.AppName = "Personnel Analytics"
 		params := gridHandler.ParseParams(r)
-		result, err := gridHandler.FetchData(params)
+		result, err := gridHandler.ExecuteQueryParams(r.Context(), params)
+		var verr *datagrid.ValidationError
+		if errors.As(err, &verr) {
+			tmpl.ExecuteTemplate(w, "datagrid_param_errors", &datagrid.TableResult{
+				QueryParams: gridHandler.QueryParams,
+				ParamErrors: verr.Errors,
+			})
+			return
+		}
+		var terr *datagrid.TimeoutError
+		if errors.As(err, &terr) {
+			tmpl.ExecuteTemplate(w, "datagrid_timeout", terr)
+			return
+		}
+		var ferr *datagrid.FilterError
+		if errors.As(err, &ferr) {
+			tmpl.ExecuteTemplate(w, "datagrid_filter_error", ferr)
+			return
+		}
 		if err != nil {
 			slog.Error("handler error", "error", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -276,8 +333,68 @@ func main() {
 		tmpl.ExecuteTemplate(w, "datagrid_table", result)
 	})
 
+	http.HandleFunc("/options", func(w http.ResponseWriter, r *http.Request) {
+		catParam := r.URL.Query().Get("config")
+		if catParam == "" {
+			catParam = "query_demo"
+		}
+		catPath := fmt.Sprintf("internal/data/catalog/%s.json", catParam)
+		gridHandler, err := datagrid.NewHandlerFromCatalogContext(r.Context(), db, catPath, "en")
+		if err != nil {
+			slog.Error("Error loading catalog", "cat_param", catParam, "error", err)
+			http.Error(w, fmt.Sprintf("Error loading catalog: %v", err), http.StatusInternalServerError)
+			return
+		}
+		gridHandler.ServeOptions(w, r)
+	})
+
+	http.HandleFunc("/row", func(w http.ResponseWriter, r *http.Request) {
+		catParam := r.URL.Query().Get("config")
+		if catParam == "" {
+			catParam = "personnel"
+		}
+		catPath := fmt.Sprintf("internal/data/catalog/%s.json", catParam)
+		gridHandler, err := datagrid.NewHandlerFromCatalogContext(r.Context(), db, catPath, "en")
+		if err != nil {
+			slog.Error("Error loading catalog", "cat_param", catParam, "error", err)
+			http.Error(w, fmt.Sprintf("Error loading catalog: %v", err), http.StatusInternalServerError)
+			return
+		}
+		gridHandler.ListEndpoint = "/list?config=" + catParam
+		gridHandler.ServeRow(w, r)
+	})
+
+	http.HandleFunc("/cell", func(w http.ResponseWriter, r *http.Request) {
+		catParam := r.URL.Query().Get("config")
+		if catParam == "" {
+			catParam = "personnel"
+		}
+		catPath := fmt.Sprintf("internal/data/catalog/%s.json", catParam)
+		gridHandler, err := datagrid.NewHandlerFromCatalogContext(r.Context(), db, catPath, "en")
+		if err != nil {
+			slog.Error("Error loading catalog", "cat_param", catParam, "error", err)
+			http.Error(w, fmt.Sprintf("Error loading catalog: %v", err), http.StatusInternalServerError)
+			return
+		}
+		gridHandler.CellEndpoint = "/cell?config=" + catParam
+		gridHandler.ServeCell(w, r)
+	})
+
+	// Demo identity: a fronting auth proxy would set these headers. The values
+	// reach constant:current_user / :tenant_id parameters through the request context.
+	withConstants := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		values := make(map[string]interface{})
+		if u := r.Header.Get("X-Remote-User"); u != "" {
+			values["current_user"] = u
+		}
+		if t := r.Header.Get("X-Tenant-Id"); t != "" {
+			values["tenant_id"] = t
+		}
+		http.DefaultServeMux.ServeHTTP(w, r.WithContext(datagrid.WithConstants(r.Context(), values)))
+	})
+
 	fmt.Printf("Server starting at http://localhost:%s\n", cfg.Server.Port)
-	if err := http.ListenAndServe(":"+cfg.Server.Port, nil); err != nil {
+	if err := http.ListenAndServe(":"+cfg.Server.Port, withConstants); err != nil {
 		slog.Error("Server error", "error", err)
 		os.Exit(1)
 	}
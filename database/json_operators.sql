@@ -1,6 +1,6 @@
 -- Comprehensive JSONB Utility Suite for Datagrid
 -- Ported and adapted from Zafir/MKE/MKS logic
--- Supports: text, boolean, numeric, integer, timestamp, tstzrange (Scalar & Array, Key & Path)
+-- Supports: text, boolean, numeric, integer, timestamp, timestamptz, tstzrange (Scalar & Array, Key & Path)
 SET search_path TO public,
     datagrid;
 -------------------------------------------------------------------------------
@@ -12,6 +12,8 @@ CREATE OR REPLACE FUNCTION public.jsonb_extract_bigint(j jsonb, key text) RETURN
 CREATE OR REPLACE FUNCTION public.jsonb_extract_integer(j jsonb, key text) RETURNS integer LANGUAGE sql IMMUTABLE PARALLEL SAFE RETURN (j->>key)::integer;
 CREATE OR REPLACE FUNCTION public.jsonb_extract_boolean(j jsonb, key text) RETURNS boolean LANGUAGE sql IMMUTABLE PARALLEL SAFE RETURN (j->>key)::boolean;
 CREATE OR REPLACE FUNCTION public.jsonb_extract_timestamp(j jsonb, key text) RETURNS timestamp LANGUAGE sql IMMUTABLE PARALLEL SAFE RETURN (j->>key)::timestamp;
+-- .datetime() keeps the offset of the value; STABLE because values without one use the session TimeZone
+CREATE OR REPLACE FUNCTION public.jsonb_extract_timestamptz(j jsonb, key text) RETURNS timestamptz LANGUAGE sql STABLE PARALLEL SAFE RETURN (jsonb_path_query_first_tz(j->key, '$.datetime()') #>> '{}')::timestamptz;
 CREATE OR REPLACE FUNCTION public.jsonb_extract_tstzrange(j jsonb, key text) RETURNS tstzrange LANGUAGE sql IMMUTABLE PARALLEL SAFE RETURN (j->>key)::tstzrange;
 -- 1.2 Path Extractions
 CREATE OR REPLACE FUNCTION public.jsonb_path_extract_numeric(j jsonb, path text []) RETURNS numeric LANGUAGE sql IMMUTABLE PARALLEL SAFE RETURN (j#>>path)::numeric;
@@ -19,6 +21,7 @@ CREATE OR REPLACE FUNCTION public.jsonb_path_extract_bigint(j jsonb, path text [
 CREATE OR REPLACE FUNCTION public.jsonb_path_extract_integer(j jsonb, path text []) RETURNS integer LANGUAGE sql IMMUTABLE PARALLEL SAFE RETURN (j#>>path)::integer;
 CREATE OR REPLACE FUNCTION public.jsonb_path_extract_boolean(j jsonb, path text []) RETURNS boolean LANGUAGE sql IMMUTABLE PARALLEL SAFE RETURN (j#>>path)::boolean;
 CREATE OR REPLACE FUNCTION public.jsonb_path_extract_timestamp(j jsonb, path text []) RETURNS timestamp LANGUAGE sql IMMUTABLE PARALLEL SAFE RETURN (j#>>path)::timestamp;
+CREATE OR REPLACE FUNCTION public.jsonb_path_extract_timestamptz(j jsonb, path text []) RETURNS timestamptz LANGUAGE sql STABLE PARALLEL SAFE RETURN (jsonb_path_query_first_tz(j#>path, '$.datetime()') #>> '{}')::timestamptz;
 CREATE OR REPLACE FUNCTION public.jsonb_path_extract_tstzrange(j jsonb, path text []) RETURNS tstzrange LANGUAGE sql IMMUTABLE PARALLEL SAFE RETURN (j#>>path)::tstzrange;
 -- 1.3 Array Extractions (with flattening if needed)
 CREATE OR REPLACE FUNCTION public.jsonb_extract_text_array(j jsonb, key text) RETURNS text [] LANGUAGE sql IMMUTABLE PARALLEL SAFE RETURN CASE
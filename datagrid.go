@@ -1,16 +1,20 @@
 package datagrid
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,7 +27,9 @@ func sanitizeParam(s string) string {
 	return strings.ReplaceAll(s, "'", "''")
 }
 func (h *Handler) ParseParams(r *http.Request) RequestParams {
-	q := r.URL.Query()
+	// r.Form merges the URL query with a POSTed parameter form (query mode)
+	r.ParseForm()
+	q := r.Form
 	limit := 10
 	if l := q.Get("limit"); l != "" {
 		fmt.Sscanf(l, "%d", &limit)
@@ -36,19 +42,42 @@ func (h *Handler) ParseParams(r *http.Request) RequestParams {
 		fmt.Sscanf(o, "%d", &offset)
 	}
 
+	paramNames := make(map[string]bool, len(h.QueryParams))
+	for _, qp := range h.QueryParams {
+		for _, key := range qp.formKeys() {
+			paramNames[key] = true
+		}
+	}
+
 	filters := make(map[string][]string)
-	for key, values := range q {
-		if key != "search" && key != "sort" && key != "limit" && key != "offset" && key != "code" && key != "_" {
-			filters[key] = values
+	values := make(map[string][]string)
+	columnSearch := make(map[string]string)
+	for key, vals := range q {
+		if paramNames[key] {
+			values[key] = vals
+			continue
+		}
+		if field := strings.TrimPrefix(key, columnSearchPrefix); field != key {
+			if v := strings.TrimSpace(q.Get(key)); v != "" && field != "" {
+				columnSearch[field] = v
+			}
+			continue
+		}
+		if key != "search" && key != "q" && key != "cursor" && key != "sort" && key != "limit" && key != "offset" && key != "code" && key != "_" {
+			filters[key] = vals
 		}
 	}
 
 	return RequestParams{
-		Search:  q.Get("search"),
-		Sort:    q["sort"],
-		Filters: filters,
-		Limit:   limit,
-		Offset:  offset,
+		Search:       q.Get("search"),
+		ColumnSearch: columnSearch,
+		Query:        q.Get("q"),
+		Cursor:       q.Get("cursor"),
+		Sort:         q["sort"],
+		Filters:      filters,
+		Values:       values,
+		Limit:        limit,
+		Offset:       offset,
 	}
 }
 
@@ -93,13 +122,25 @@ type Handler struct {
 	ListEndpoint        string // Default endpoint for HTMX updates
 	PivotEndpoint       string // Endpoint for pivot data
 	ExecuteEndpoint     string // Endpoint for query execution
+	OptionsEndpoint     string // Endpoint for dependent LOV options refresh (see ServeOptions)
+	CellEndpoint        string // Endpoint for inline cell edits (see ServeCell); enables them when edit is on
 	LOVChooserThreshold int
 	AppName             string
 	Catalogs            map[string]string
-	QueryParams         []QueryParam // Resolved parameters (with LOV options populated)
-	QuerySQL            string       // Raw SQL template with :param placeholders
-	IsQueryMode         bool         // true when catalog type == "query"
-	CurrentUser         string       // Set by host app for constant:current_user resolution
+	QueryParams         []QueryParam                // Resolved parameters (with LOV options populated)
+	QuerySQL            string                      // Raw SQL template with :param placeholders
+	IsQueryMode         bool                        // true when catalog type == "query"
+	CurrentUser         string                      // Set by host app for constant:current_user resolution
+	Constants           map[string]ConstantResolver // Per-handler constant resolvers, checked before RegisterConstant
+	SessionSettings     []SessionSetting            // Per-handler RLS session settings, replacing SetSessionSettings
+
+	joins       string            // JOIN clauses of the catalog's secondary objects
+	columnExprs map[string]string // Field -> SQL expression (see resolveSources)
+
+	versionMu   sync.Mutex // Guards versionKind
+	versionKind int        // How rows without version_column are versioned (see resolveVersion)
+
+	sqlTemplates sqlTemplateSet // Statement templates; the registered set when nil
 }
 
 func NewHandler(db *sql.DB, tableName string, cols []UIColumn, cfg DatagridConfig) *Handler {
@@ -113,11 +154,16 @@ func NewHandler(db *sql.DB, tableName string, cols []UIColumn, cfg DatagridConfi
 
 // NewHandlerFromCatalog initializes a Handler using a MIGR/JiraMntr JSON catalog file
 func NewHandlerFromCatalog(db *sql.DB, catalogPath string, lang string) (*Handler, error) {
+	return NewHandlerFromCatalogContext(context.Background(), db, catalogPath, lang)
+}
+
+// NewHandlerFromCatalogContext is NewHandlerFromCatalog with the LOV queries bound to ctx.
+func NewHandlerFromCatalogContext(ctx context.Context, db *sql.DB, catalogPath string, lang string) (*Handler, error) {
 	data, err := os.ReadFile(catalogPath)
 	if err != nil {
 		return nil, err
 	}
-	return NewHandlerFromData(db, data, lang)
+	return NewHandlerFromDataContext(ctx, db, data, lang)
 }
 
 // NewHandlerFromDataWithUser initializes a Handler with user context for RLS-aware LOV resolution.
@@ -128,50 +174,20 @@ func NewHandlerFromDataWithUser(db *sql.DB, data []byte, lang string, currentUse
 	}
 	h.CurrentUser = currentUser
 
-	// Re-resolve LOV queries that reference :current_user (RLS)
-	for i := range h.QueryParams {
-		lovSQL := h.QueryParams[i].resolvedLOVQuery()
-		if lovSQL != "" && strings.Contains(lovSQL, ":current_user") {
-			lovSQL = strings.ReplaceAll(lovSQL, ":current_user", "'"+strings.ReplaceAll(currentUser, "'", "''")+"'")
-			h.QueryParams[i].Options = nil // Clear stale options
-
-			itype := h.QueryParams[i].InputType()
-			rows, err := db.Query(lovSQL)
-			if err == nil {
-				defer rows.Close()
-				cols, _ := rows.Columns()
-				nCols := len(cols)
-				for rows.Next() {
-					switch {
-					case itype == "lov-tree" && nCols >= 3:
-						var val, label string
-						var depth int
-						if err := rows.Scan(&val, &label, &depth); err == nil {
-							h.QueryParams[i].Options = append(h.QueryParams[i].Options, LOVItem{Value: val, Label: label, Depth: depth})
-						}
-					case nCols >= 2:
-						var val, label string
-						if err := rows.Scan(&val, &label); err == nil {
-							h.QueryParams[i].Options = append(h.QueryParams[i].Options, LOVItem{Value: val, Label: label})
-						}
-					default:
-						var val string
-						if err := rows.Scan(&val); err == nil {
-							h.QueryParams[i].Options = append(h.QueryParams[i].Options, LOVItem{Value: val, Label: val})
-						}
-					}
-				}
-			} else {
-				slog.Error("RLS LOV query error for param", "name", h.QueryParams[i].Name, "error", err)
-			}
-		}
-	}
+	// Resolve LOV queries that reference :current_user and other constants (RLS)
+	h.LoadConstantOptions(context.Background())
 
 	return h, nil
 }
 
 // NewHandlerFromData initializes a Handler using MIGR/JiraMntr JSON data (bytes)
 func NewHandlerFromData(db *sql.DB, data []byte, lang string) (*Handler, error) {
+	return NewHandlerFromDataContext(context.Background(), db, data, lang)
+}
+
+// NewHandlerFromDataContext is NewHandlerFromData with the column and parameter LOV
+// queries bound to ctx, so a cancelled request stops them.
+func NewHandlerFromDataContext(ctx context.Context, db *sql.DB, data []byte, lang string) (*Handler, error) {
 	var cat Catalog
 	if err := json.Unmarshal(data, &cat); err != nil {
 		return nil, err
@@ -201,6 +217,7 @@ func NewHandlerFromData(db *sql.DB, data []byte, lang string) (*Handler, error)
 	if len(cat.Objects) == 0 {
 		return nil, fmt.Errorf("no objects found in catalog")
 	}
+	mergeVirtualColumns(&cat)
 
 	obj := cat.Objects[0]
 
@@ -235,6 +252,8 @@ func NewHandlerFromData(db *sql.DB, data []byte, lang string) (*Handler, error)
 						fd.Type = "int_bool"
 					case "integer", "int", "numeric":
 						fd.Type = "number"
+					case "date", "timestamp", "timestamptz":
+						fd.Type = "date"
 					default:
 						fd.Type = "text"
 					}
@@ -307,7 +326,7 @@ func NewHandlerFromData(db *sql.DB, data []byte, lang string) (*Handler, error)
 				}
 			} else if strings.Contains(strings.ToUpper(v), "SELECT") {
 				query := strings.ReplaceAll(v, "{lang}", lang)
-				rows, err := db.Query("SELECT datagrid.datagrid_execute_json($1, '{}'::jsonb)", query)
+				rows, err := db.QueryContext(ctx, "SELECT datagrid.datagrid_execute_json($1, '{}'::jsonb)", query)
 				if err == nil {
 					defer rows.Close()
 					for rows.Next() {
@@ -379,10 +398,12 @@ func NewHandlerFromData(db *sql.DB, data []byte, lang string) (*Handler, error)
 		var cssClass string
 		var displayPattern string
 		var linkPattern string
+		var aggregate string
 		if override, ok := cat.Datagrid.Columns[col.Name]; ok {
 			cssClass = override.CSS
 			displayPattern = override.Display
 			linkPattern = override.Link
+			aggregate = strings.ToLower(strings.TrimSpace(override.Aggregate))
 		}
 
 		// Hardcode Elimination: Automatically add generic classes based on metadata
@@ -403,17 +424,19 @@ func NewHandlerFromData(db *sql.DB, data []byte, lang string) (*Handler, error)
 		}
 
 		uiCols = append(uiCols, UIColumn{
-			Field:    col.Name,
-			Label:    label,
-			CSS:      cssClass,
-			Display:  displayPattern,
-			Sortable: true,
-			Visible:  visible,
-			Record:   true,
-			Type:     strings.ToLower(col.Type),
-			Icon:     icon,
-			Link:     linkPattern,
-			LOV:      lovItems,
+			Field:     col.Name,
+			Label:     label,
+			CSS:       cssClass,
+			Display:   displayPattern,
+			Sortable:  true,
+			Visible:   visible,
+			Record:    true,
+			Type:      strings.ToLower(col.Type),
+			Icon:      icon,
+			Link:      linkPattern,
+			LOV:       lovItems,
+			Range:     rangeInput(cat.Datagrid.Filters[col.Name]),
+			Aggregate: aggregate,
 		})
 
 	}
@@ -432,13 +455,16 @@ func NewHandlerFromData(db *sql.DB, data []byte, lang string) (*Handler, error)
 		Lang:             lang,
 		IconStyleLibrary: iconStyle,
 	}
+	if err := h.resolveSources(); err != nil {
+		return nil, err
+	}
 
 	// Query mode: resolve parameters from catalog
 	if strings.ToLower(cat.Type) == "query" && len(cat.Parameters) > 0 {
 		h.IsQueryMode = true
 		h.QuerySQL = cat.SQL
 
-		today := time.Now().Format("2006-01-02")
+		now := time.Now()
 		params := make([]QueryParam, len(cat.Parameters))
 		copy(params, cat.Parameters)
 
@@ -449,6 +475,14 @@ func NewHandlerFromData(db *sql.DB, data []byte, lang string) (*Handler, error)
 				params[i].Type = strings.TrimSuffix(params[i].Type, "[]")
 			}
 
+			if params[i].Pattern != "" {
+				re, err := regexp.Compile(params[i].Pattern)
+				if err != nil {
+					return nil, fmt.Errorf("parameter %s: invalid pattern: %w", params[i].Name, err)
+				}
+				params[i].pattern = re
+			}
+
 			// Resolve select options
 			if itype := params[i].InputType(); itype == "select" {
 				opts := params[i].resolvedSelectOptions()
@@ -460,54 +494,54 @@ func NewHandlerFromData(db *sql.DB, data []byte, lang string) (*Handler, error)
 				}
 			}
 
-			// Resolve LOV/tree/grouped options from DB
-			itype := params[i].InputType()
-			lovSQL := params[i].resolvedLOVQuery()
-			if lovSQL != "" && (itype == "lov" || itype == "lov-multi" || itype == "lov-tree" || itype == "lov-grouped") {
-				rows, err := db.Query(lovSQL)
-				if err == nil {
-					defer rows.Close()
-					cols, _ := rows.Columns()
-					nCols := len(cols)
-					for rows.Next() {
-						switch {
-						case itype == "lov-tree" && nCols >= 3:
-							var val, label string
-							var depth int
-							if err := rows.Scan(&val, &label, &depth); err == nil {
-								params[i].Options = append(params[i].Options, LOVItem{Value: val, Label: label, Depth: depth})
-							}
-						case itype == "lov-grouped" && nCols >= 3:
-							var group, val, label string
-							if err := rows.Scan(&group, &val, &label); err == nil {
-								params[i].Options = append(params[i].Options, LOVItem{Value: val, Label: label, Group: group})
-							}
-						case nCols >= 2:
-							var val, label string
-							if err := rows.Scan(&val, &label); err == nil {
-								params[i].Options = append(params[i].Options, LOVItem{Value: val, Label: label})
-							}
-						default:
-							var val string
-							if err := rows.Scan(&val); err == nil {
-								params[i].Options = append(params[i].Options, LOVItem{Value: val, Label: val})
-							}
-						}
-					}
-				} else {
-					slog.Error("LOV query error for param", "name", params[i].Name, "error", err)
-				}
-			}
-
-			// Resolve default dates
+			// Resolve default dates ("CURRENT_DATE - 30", start_of_month, ...);
+			// daterange defaults are resolved per request
 			def := params[i].Default
-			if def == "CURRENT_DATE" || def == "CURRENT_TIMESTAMP" {
-				params[i].ResolvedDefault = today
+			if params[i].InputType() == "daterange" {
+				continue
+			}
+			if d, ok := resolveDateExpr(def, now); ok && params[i].isDateDefault() {
+				params[i].ResolvedDefault = d.Format(dateLayout)
 			} else if def != "" && def != "NULL" && def != "Session user" {
 				params[i].ResolvedDefault = def
 			}
 		}
 		h.QueryParams = params
+
+		// Resolve LOV/tree/grouped options from DB once defaults are known, so
+		// dependent LOVs start out filtered by their parents' defaults. LOVs that
+		// depend on the requester need a request context (see QueryParamsContext);
+		// the shared ones run in one transaction with the fixed session settings.
+		var lovTx *sql.Tx
+		for i := range params {
+			params[i].DependsOn = params[i].lovDependencies(params)
+			if !isLOVInput(params[i].InputType()) || params[i].resolvedLOVQuery() == "" || h.optionsPerRequest(params[i]) {
+				continue
+			}
+			if h.DB == nil {
+				break
+			}
+			if lovTx == nil {
+				tx, err := h.beginTx(ctx, fixedSessionSettings(h.sessionSettings()))
+				if err != nil {
+					slog.Error("LOV query error for param", "name", params[i].Name, "error", err)
+					break
+				}
+				lovTx = tx
+			}
+			opts, err := h.queryParamOptions(ctx, lovTx, params[i], nil)
+			if err != nil {
+				// The failed statement aborted the transaction; the next LOV opens a new one
+				slog.Error("LOV query error for param", "name", params[i].Name, "error", err)
+				lovTx.Rollback()
+				lovTx = nil
+				continue
+			}
+			params[i].Options = opts
+		}
+		if lovTx != nil {
+			lovTx.Rollback()
+		}
 	}
 
 	return h, nil
@@ -516,15 +550,6 @@ func NewHandlerFromData(db *sql.DB, data []byte, lang string) (*Handler, error)
 // ServeHTTP handles the grid lifecycle: metadata, filters, data, and templates.
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	params := h.ParseParams(r)
-	
-	result, err := h.Execute(params)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	result.Lang = h.Lang
-	result.CurrentLang = h.Lang
-	result.ListEndpoint = h.ListEndpoint
 
 	funcs := TemplateFuncs()
 	tmpl, err := template.New("datagrid").Funcs(funcs).ParseFS(UIAssets, 
@@ -535,6 +560,47 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	result, err := h.ExecuteContext(r.Context(), params)
+	var verr *ValidationError
+	if errors.As(err, &verr) {
+		// Rendered with 200 so HTMX swaps the per-field messages into the form
+		res := &TableResult{QueryParams: h.QueryParams, ParamErrors: verr.Errors}
+		if err := tmpl.ExecuteTemplate(w, "datagrid_param_errors", res); err != nil {
+			slog.Error("datagrid render error", "error", err)
+		}
+		return
+	}
+	var terr *TimeoutError
+	if errors.As(err, &terr) {
+		// Rendered with 200 as well, so the message replaces the grid
+		if err := tmpl.ExecuteTemplate(w, "datagrid_timeout", terr); err != nil {
+			slog.Error("datagrid render error", "error", err)
+		}
+		return
+	}
+	var ferr *FilterError
+	if errors.As(err, &ferr) {
+		if err := tmpl.ExecuteTemplate(w, "datagrid_filter_error", ferr); err != nil {
+			slog.Error("datagrid render error", "error", err)
+		}
+		return
+	}
+	if r.Context().Err() != nil {
+		return // client went away
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result.Lang = h.Lang
+	result.CurrentLang = h.Lang
+	result.ListEndpoint = h.ListEndpoint
+	if h.IsQueryMode && r.Header.Get("HX-Request") == "" {
+		// Full page with the parameter form: resolve the requester's LOV options.
+		// HTMX pages, sorts and filters keep the shared ones.
+		result.QueryParams = h.QueryParamsContext(r.Context())
+	}
+
 	if err := tmpl.ExecuteTemplate(w, "datagrid_full", result); err != nil {
 		slog.Error("datagrid render error", "error", err)
 	}
@@ -545,6 +611,11 @@ func (h *Handler) Execute(params RequestParams) (*TableResult, error) {
 	return h.FetchData(params)
 }
 
+// ExecuteContext is Execute bound to the request context.
+func (h *Handler) ExecuteContext(ctx context.Context, params RequestParams) (*TableResult, error) {
+	return h.FetchDataContext(ctx, params)
+}
+
 func processLovItem(item LOVItem, lang string) LOVItem {
 	li := LOVItem{
 		Value:    item.Value,
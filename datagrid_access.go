@@ -0,0 +1,286 @@
+package datagrid
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Column masks (datagrid.columns.<field>.mask), applied in the SQL projection so the
+// clear value never leaves the database.
+const (
+	maskEmail = "email" // first character and domain: j***@example.com
+	maskLast4 = "last4" // all but the last four characters starred: ******1234
+	maskHash  = "hash"  // SHA-256 hex digest: stable pseudonym, still groups and counts
+	maskNull  = "null"  // NULL
+)
+
+// accessHidden marks a restricted column without a mask: it is left out altogether.
+const accessHidden = "-"
+
+// columnAccess maps the columns a request may not see in clear to their mask, or to
+// accessHidden. Columns not listed are unrestricted.
+type columnAccess map[string]string
+
+func (a columnAccess) restricted(field string) bool {
+	_, ok := a[field]
+	return ok
+}
+
+// fieldPath returns what a request field reads as a path: the JSON column and keys of a
+// dyn- field or of a JSON column (path), the column name alone otherwise.
+func (h *Handler) fieldPath(field string) []string {
+	if strings.HasPrefix(field, dynPrefix) {
+		if column, keys, ok := h.dynPath(field); ok {
+			return append([]string{column}, keys...)
+		}
+		return strings.Split(strings.TrimPrefix(field, dynPrefix), ".")
+	}
+	if path := h.Config.Columns[field].Path; path != "" {
+		return strings.Split(path, ".")
+	}
+	if strings.Contains(field, "->") { // catalog filter column like data->>'ssn'
+		var path []string
+		for _, part := range arrowPattern.Split(field, -1) {
+			path = append(path, strings.Trim(strings.TrimPrefix(strings.TrimSpace(part), "src."), `'"`))
+		}
+		return path
+	}
+	return []string{field}
+}
+
+var arrowPattern = regexp.MustCompile(`\s*->>?\s*`)
+
+// restrictedField reports whether field reveals a restricted column under access: it is
+// one, or its path and the path of a restricted column overlap (one contains the other),
+// as for dyn-data.ssn when data or the JSON column data.ssn is restricted, or for dyn-data
+// when a key of data is.
+func (h *Handler) restrictedField(access columnAccess, field string) bool {
+	if len(access) == 0 {
+		return false
+	}
+	if access.restricted(field) {
+		return true
+	}
+	path := h.fieldPath(field)
+	for restricted := range access {
+		rpath := h.fieldPath(restricted)
+		n := min(len(path), len(rpath))
+		if slices.Equal(path[:n], rpath[:n]) {
+			return true
+		}
+	}
+	return false
+}
+
+// accessForRoles works out the restricted columns for a user holding roles: a column
+// with roles is clear to those roles only, a column with a mask but no roles is masked
+// for everyone.
+func (h *Handler) accessForRoles(roles []string) columnAccess {
+	held := make(map[string]bool, len(roles))
+	for _, r := range roles {
+		held[strings.TrimSpace(r)] = true
+	}
+	access := columnAccess{}
+	for field, def := range h.Config.Columns {
+		if len(def.Roles) == 0 && def.Mask == "" {
+			continue
+		}
+		allowed := false
+		for _, r := range def.Roles {
+			allowed = allowed || held[r]
+		}
+		if allowed {
+			continue
+		}
+		switch mask := strings.ToLower(strings.TrimSpace(def.Mask)); mask {
+		case maskEmail, maskLast4, maskHash, maskNull:
+			access[field] = mask
+		default:
+			access[field] = accessHidden
+		}
+	}
+	return access
+}
+
+// currentRoles reads the request's roles from the current_roles constant (see
+// RegisterConstant, WithConstants): a []string or a comma-separated string. No resolver
+// means no roles.
+func (h *Handler) currentRoles(ctx context.Context) ([]string, error) {
+	v, ok, err := h.resolveConstant(ctx, "current_roles")
+	if err != nil || !ok {
+		return nil, err
+	}
+	switch roles := v.(type) {
+	case []string:
+		return roles, nil
+	case string:
+		if roles == "" {
+			return nil, nil
+		}
+		return strings.Split(roles, ","), nil
+	case nil:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("constant current_roles: unsupported type %T", v)
+}
+
+// resolveAccess sets the request's column access from the roles of ctx and drops the
+// sorts, filters and column searches on restricted columns or JSON paths into them (see
+// restrictedField), which would otherwise reveal the values through the rows they select,
+// their order or the keyset cursor.
+func (h *Handler) resolveAccess(ctx context.Context, p *RequestParams) error {
+	roles, err := h.currentRoles(ctx)
+	if err != nil {
+		return err
+	}
+	p.access = h.accessForRoles(roles)
+	h.restrictParams(p)
+	return nil
+}
+
+// ensureAccess applies the access of a user without roles when the caller resolved none
+// (BuildGridSQL and the other entry points without a context).
+func (h *Handler) ensureAccess(p *RequestParams) {
+	if p.access == nil {
+		p.access = h.accessForRoles(nil)
+		h.restrictParams(p)
+	}
+}
+
+func (h *Handler) restrictParams(p *RequestParams) {
+	if len(p.access) == 0 {
+		return
+	}
+
+	var sorts []string
+	for _, s := range p.Sort {
+		var kept []string
+		for _, part := range strings.Split(s, ",") {
+			field := strings.TrimSpace(part)
+			if i := strings.IndexAny(field, ": "); i >= 0 {
+				field = field[:i]
+			}
+			if !h.restrictedField(p.access, field) {
+				kept = append(kept, part)
+			}
+		}
+		if len(kept) > 0 {
+			sorts = append(sorts, strings.Join(kept, ","))
+		}
+	}
+	p.Sort = sorts
+
+	filters := make(map[string][]string, len(p.Filters))
+	for key, vals := range p.Filters {
+		field := key
+		if fd, _, ok := h.lookupFilter(key); ok {
+			field = fd.Column
+			if field == "" {
+				field = h.filterName(key)
+			}
+		}
+		if !h.restrictedField(p.access, field) {
+			filters[key] = vals
+		}
+	}
+	p.Filters = filters
+
+	searches := make(map[string]string, len(p.ColumnSearch))
+	for field, v := range p.ColumnSearch {
+		if !h.restrictedField(p.access, field) {
+			searches[field] = v
+		}
+	}
+	p.ColumnSearch = searches
+}
+
+// maskSQL wraps a column expression in its mask.
+func maskSQL(expr, mask string) string {
+	text := "(" + expr + ")::text"
+	switch mask {
+	case maskEmail:
+		return fmt.Sprintf(`regexp_replace(%s, '^(.)[^@]*', '\1***')`, text)
+	case maskLast4:
+		return fmt.Sprintf("repeat('*', greatest(length(%s) - 4, 0)) || right(%s, 4)", text, text)
+	case maskHash:
+		return fmt.Sprintf("encode(sha256(convert_to(%s, 'UTF8')), 'hex')", text)
+	}
+	return "NULL::text"
+}
+
+// projectedExpr is the SQL a statement selects for field under access: the column, its
+// mask, or "" when the column is hidden. A jsonb column loses the keys read by restricted
+// JSON columns (path), so the detail sidebar cannot show them either.
+func (h *Handler) projectedExpr(access columnAccess, field string) string {
+	mask, ok := access[field]
+	switch {
+	case ok && mask == accessHidden:
+		return ""
+	case ok:
+		return maskSQL(h.columnExpr(field), mask)
+	}
+
+	expr := h.columnExpr(field)
+	for restricted := range access {
+		keys := strings.Split(h.Config.Columns[restricted].Path, ".")
+		if len(keys) < 2 || keys[0] != field {
+			continue
+		}
+		for i, k := range keys[1:] {
+			keys[i+1] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "'", "''").Replace(k) + `"`
+		}
+		expr = fmt.Sprintf("(%s #- '{%s}')", expr, strings.Join(keys[1:], ","))
+	}
+	return expr
+}
+
+// visibleColumns returns the UI columns for access: hidden ones left out, masked ones
+// flagged and no longer sortable or filterable.
+func (h *Handler) visibleColumns(access columnAccess) []UIColumn {
+	if len(access) == 0 {
+		return h.Columns
+	}
+	cols := make([]UIColumn, 0, len(h.Columns))
+	for _, c := range h.Columns {
+		mask, ok := access[c.Field]
+		if ok && mask == accessHidden {
+			continue
+		}
+		if ok {
+			c.Masked, c.Sortable, c.LOV, c.Range, c.Aggregate = mask, false, nil, "", ""
+		}
+		cols = append(cols, c)
+	}
+	return cols
+}
+
+// ColumnsContext returns the columns the user of ctx may see (roles from the
+// current_roles constant), for hosts rendering the page around the grid.
+func (h *Handler) ColumnsContext(ctx context.Context) ([]UIColumn, error) {
+	roles, err := h.currentRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.visibleColumns(h.accessForRoles(roles)), nil
+}
+
+// queryProjection is the select list of a query-mode statement under access: "*" when
+// nothing is restricted, otherwise the known columns, masked, without the hidden ones.
+func (h *Handler) queryProjection(access columnAccess) string {
+	if len(access) == 0 {
+		return "*"
+	}
+	var cols []string
+	for _, c := range h.Columns {
+		if expr := h.projectedExpr(access, c.Field); expr != "" {
+			cols = append(cols, fmt.Sprintf("%s AS %s", expr, quote_ident(c.Field)))
+		}
+	}
+	if len(cols) == 0 {
+		return "NULL AS none"
+	}
+	return strings.Join(cols, ", ")
+}
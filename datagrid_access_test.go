@@ -0,0 +1,203 @@
+package datagrid
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const accessCatalog = `{
+	"version": "2.0",
+	"title": "People",
+	"objects": [{"name": "app.people", "columns": [
+		{"name": "id", "type": "integer", "primary_key": true},
+		{"name": "name", "type": "text"},
+		{"name": "email", "type": "text"},
+		{"name": "salary", "type": "numeric"},
+		{"name": "status", "type": "text"},
+		{"name": "data", "type": "jsonb"}
+	]}],
+	"datagrid": {
+		"facets": true,
+		"columns": {
+			"id": {}, "name": {}, "data": {},
+			"email": {"roles": ["hr"], "mask": "email"},
+			"salary": {"roles": ["hr", "payroll"]},
+			"status": {"roles": ["hr"], "mask": "hash", "lov": [{"value": "A", "label": "Active"}, {"value": "T", "label": "Terminated"}]},
+			"ssn": {"path": "data.ssn", "type": "text", "roles": ["hr"]}
+		},
+		"filters": {
+			"name": {"type": "text", "operators": ["contains"]},
+			"status": {"type": "text"},
+			"salary": {"type": "number", "operators": ["gte"]},
+			"ssn": {"column": "data->>'ssn'", "type": "text"}
+		}
+	}
+}`
+
+func accessHandler(t *testing.T) *Handler {
+	t.Helper()
+	h, err := NewHandlerFromData(nil, []byte(accessCatalog), "en")
+	if err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	return h
+}
+
+func TestAccessForRoles(t *testing.T) {
+	h := accessHandler(t)
+	tests := []struct {
+		name  string
+		roles []string
+		want  columnAccess
+	}{
+		{"no roles", nil, columnAccess{"email": maskEmail, "salary": accessHidden, "status": maskHash, "ssn": accessHidden}},
+		{"hr", []string{"hr"}, columnAccess{}},
+		{"payroll", []string{"payroll"}, columnAccess{"email": maskEmail, "status": maskHash, "ssn": accessHidden}},
+		{"padded", []string{" hr "}, columnAccess{}},
+		{"unknown role", []string{"HR"}, columnAccess{"email": maskEmail, "salary": accessHidden, "status": maskHash, "ssn": accessHidden}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.accessForRoles(tt.roles); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("access = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestrictedField(t *testing.T) {
+	h := accessHandler(t)
+	access := h.accessForRoles([]string{"payroll"})
+	tests := []struct {
+		field string
+		want  bool
+	}{
+		{"email", true},
+		{"ssn", true},
+		{"status", true},
+		{"salary", false},
+		{"name", false},
+		{"data", true},
+		{"dyn-data.ssn", true},
+		{"dyn-data.ssn.last", true},
+		{"dyn-data.city", false},
+		{"data->>'ssn'", true},
+		{"src.data -> 'ssn'", true},
+		{"data->>'city'", false},
+	}
+	for _, tt := range tests {
+		if got := h.restrictedField(access, tt.field); got != tt.want {
+			t.Errorf("restrictedField(%q) = %v, want %v", tt.field, got, tt.want)
+		}
+	}
+	if h.restrictedField(nil, "email") {
+		t.Error("a field is restricted without access rules")
+	}
+}
+
+func TestMaskSQL(t *testing.T) {
+	tests := []struct {
+		mask string
+		want string
+	}{
+		{maskEmail, `regexp_replace((src."email")::text, '^(.)[^@]*', '\1***')`},
+		{maskLast4, `repeat('*', greatest(length((src."email")::text) - 4, 0)) || right((src."email")::text, 4)`},
+		{maskHash, `encode(sha256(convert_to((src."email")::text, 'UTF8')), 'hex')`},
+		{maskNull, "NULL::text"},
+		{"bogus", "NULL::text"},
+	}
+	for _, tt := range tests {
+		if got := maskSQL(`src."email"`, tt.mask); got != tt.want {
+			t.Errorf("%s: mask = %s, want %s", tt.mask, got, tt.want)
+		}
+	}
+}
+
+func TestGridSQLAccess(t *testing.T) {
+	h := accessHandler(t)
+	for _, export := range []bool{false, true} {
+		p := RequestParams{
+			Limit:        10,
+			Sort:         []string{"salary:desc,name", "email"},
+			Filters:      map[string][]string{"salary__gte": {"1"}, "status": {"A"}, "ssn": {"123"}, "name__contains": {"x"}},
+			ColumnSearch: map[string]string{"email": "@corp", "name": "Ann"},
+			export:       export,
+		}
+		query, configJSON, pred, err := h.buildGridSQL(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Filters, searches and sorts on restricted columns are dropped...
+		for _, leak := range []string{"salary", "status", "ssn", "email", "@corp", "123"} {
+			if strings.Contains(pred.SQL, leak) || strings.Contains(configJSON, leak) {
+				t.Errorf("export %v: restricted column reachable through %q:\n%s\n%s", export, leak, pred.SQL, configJSON)
+			}
+		}
+		// ...and the select list masks or leaves them out
+		for _, leak := range []string{`src."salary"`, `AS "salary"`, `AS "ssn"`, `src."email" AS`, `src."status" AS`} {
+			if strings.Contains(query, leak) {
+				t.Errorf("export %v: statement selects %s:\n%s", export, leak, query)
+			}
+		}
+		for _, want := range []string{
+			`regexp_replace((src."email")::text, '^(.)[^@]*', '\1***')`,
+			`encode(sha256(convert_to((src."status")::text, 'UTF8')), 'hex')`,
+			`(src."data" #- '{"ssn"}')`,
+		} {
+			if !strings.Contains(query, want) {
+				t.Errorf("export %v: statement does not project %s:\n%s", export, want, query)
+			}
+		}
+		if want := `(src."name")::text ILIKE`; !strings.Contains(pred.SQL, want) {
+			t.Errorf("export %v: unrestricted filter dropped: %s", export, pred.SQL)
+		}
+	}
+
+	// The same request by hr keeps every column
+	p := RequestParams{Limit: 10, Sort: []string{"salary:desc"}, Filters: map[string][]string{"salary__gte": {"1"}}}
+	p.access = h.accessForRoles([]string{"hr"})
+	query, _, pred, err := h.buildGridSQL(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(pred.SQL, `src."salary" >=`) || !strings.Contains(query, `"salary" DESC`) {
+		t.Errorf("hr lost the salary filter or sort:\n%s\n%s", query, pred.SQL)
+	}
+}
+
+func TestFacetsAccess(t *testing.T) {
+	h := accessHandler(t)
+	p := RequestParams{Filters: map[string][]string{"status": {"A"}}}
+	h.ensureAccess(&p)
+	// status, the only LOV filter, is restricted: no facet query may run (tx is nil)
+	facets, err := h.facets(context.Background(), nil, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(facets) != 0 {
+		t.Errorf("facets = %v, want none", facets)
+	}
+	if _, ok := p.Filters["status"]; ok {
+		t.Error("filter on a restricted column kept")
+	}
+}
+
+func TestVisibleColumns(t *testing.T) {
+	h := accessHandler(t)
+	cols := h.visibleColumns(h.accessForRoles(nil))
+	seen := map[string]UIColumn{}
+	for _, c := range cols {
+		seen[c.Field] = c
+	}
+	if _, ok := seen["salary"]; ok {
+		t.Error("hidden column salary listed")
+	}
+	if c := seen["email"]; c.Masked != maskEmail || c.Sortable {
+		t.Errorf("email = masked %q, sortable %v", c.Masked, c.Sortable)
+	}
+	if c := seen["status"]; c.LOV != nil {
+		t.Error("masked status keeps its LOV")
+	}
+}
@@ -0,0 +1,80 @@
+package datagrid
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// aggregateFuncs maps a column's footer aggregate (datagrid.columns.<field>.aggregate)
+// to its SQL.
+var aggregateFuncs = map[string]string{
+	"sum":            "SUM(%s)",
+	"avg":            "ROUND(AVG(%s)::numeric, 2)",
+	"min":            "MIN(%s)",
+	"max":            "MAX(%s)",
+	"count":          "COUNT(%s)",
+	"count_distinct": "COUNT(DISTINCT %s)",
+}
+
+// aggregateRow computes the footer aggregates over every row matching where (the count
+// query's condition), not just the current page. It returns nil when no column declares
+// one; NULL results (no rows) and restricted columns are left out.
+func (h *Handler) aggregateRow(ctx context.Context, tx *sql.Tx, access columnAccess, source, where string, args ...interface{}) (map[string]interface{}, error) {
+	var selects []string
+	for _, c := range h.Columns {
+		tpl, ok := aggregateFuncs[c.Aggregate]
+		if !ok || !c.Record || h.restrictedField(access, c.Field) {
+			continue
+		}
+		selects = append(selects, fmt.Sprintf("%s AS %s", fmt.Sprintf(tpl, h.columnExpr(c.Field)), quote_ident(c.Field)))
+	}
+	if len(selects) == 0 {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s %s", strings.Join(selects, ", "), source, where)
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err == nil {
+		var records []map[string]interface{}
+		if records, err = scanRecords(rows); err == nil {
+			aggregates := map[string]interface{}{}
+			for _, rec := range records {
+				for field, v := range rec {
+					if v != nil {
+						aggregates[field] = v
+					}
+				}
+			}
+			return aggregates, nil
+		}
+	}
+	if os.Getenv("DEBUG_SQL") == "true" {
+		fmt.Printf("--- AGGREGATE QUERY ERROR ---\nQuery: %s\nError: %v\n------------------------\n", query, err)
+	}
+	return nil, fmt.Errorf("failed to compute aggregates: %w", h.queryError(ctx, err))
+}
+
+// formatAggregate renders a footer aggregate: averages and other fractions with two
+// decimals, whole numbers with thousands separators.
+func formatAggregate(v interface{}) string {
+	switch n := v.(type) {
+	case nil:
+		return ""
+	case int64:
+		return groupThousands(int(n))
+	case float64:
+		return fmt.Sprintf("%.2f", n)
+	case json.Number:
+		if i, err := n.Int64(); err == nil {
+			return groupThousands(int(i))
+		}
+		if f, err := n.Float64(); err == nil {
+			return fmt.Sprintf("%.2f", f)
+		}
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,289 @@
+package datagrid
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Form values of a cell edit besides the row's primary key columns.
+const (
+	cellField   = "_field"
+	cellValue   = "_value"
+	cellVersion = "_version"
+)
+
+// ConflictError is returned by UpdateCellContext when the row changed after the client
+// read it: its version (datagrid.version_column, else xmin) no longer matches.
+type ConflictError struct {
+	Field   string
+	Value   interface{} // Current value of Field on the server
+	Version string      // Current row version
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s was changed by someone else (now %v)", e.Field, e.Value)
+}
+
+// ErrNoRowVersion is returned by UpdateCellContext when rows have no version to check:
+// datagrid.version_column is unset or not a column, and the source is not known to be a
+// table (views have no xmin).
+var ErrNoRowVersion = errors.New("rows of this catalog have no version")
+
+// How rows without a version_column are versioned (Handler.versionKind).
+const (
+	versionUnknown = iota // Not resolved yet, or the lookup failed
+	versionXmin           // The source is a table: xmin
+	versionNone           // The source is a view or missing: no version
+)
+
+// inlineEdit reports whether grid cells can be edited in place: the catalog enables edit,
+// rows have a version and the host set CellEndpoint.
+func (h *Handler) inlineEdit() bool {
+	return h.CellEndpoint != "" && h.allowWrite("edit") == nil && h.versionExpr(false) != ""
+}
+
+// resolveVersion finds out, once cells can be edited (CellEndpoint set, edit enabled) and
+// rows have no version_column, whether the source is a table whose rows carry xmin. It
+// runs on the first grid read or cell edit rather than at load time, and never fails the
+// request: until it succeeds the rows have no version and cells stay read-only. A failed
+// lookup (database unreachable, source not created yet) is retried on the next request.
+func (h *Handler) resolveVersion(ctx context.Context) {
+	if h.CellEndpoint == "" || h.allowWrite("edit") != nil || h.Config.VersionColumn != "" || h.DB == nil {
+		return
+	}
+	h.versionMu.Lock()
+	defer h.versionMu.Unlock()
+	if h.versionKind != versionUnknown {
+		return
+	}
+
+	var kind sql.NullString
+	err := h.DB.QueryRowContext(ctx, "SELECT relkind::text FROM pg_class WHERE oid = to_regclass($1)",
+		quote_ident(h.TableName)).Scan(&kind)
+	switch {
+	case err == nil && (kind.String == "r" || kind.String == "p"):
+		h.versionKind = versionXmin
+	case err == nil:
+		h.versionKind = versionNone
+		slog.Warn("datagrid: cell edits need datagrid.version_column on a source that is not a table", "source", h.TableName)
+	case errors.Is(err, sql.ErrNoRows):
+		slog.Warn("datagrid: source not found, cell edits disabled", "source", h.TableName)
+	default:
+		slog.Warn("datagrid: cannot read source kind, cell edits disabled", "source", h.TableName, "error", err)
+	}
+}
+
+// versionColumn returns the stored column that changes on every write of a row, or ""
+// when rows are versioned by the system column xmin.
+func (h *Handler) versionColumn() string {
+	if _, ok := h.storedColumn(h.Config.VersionColumn); ok {
+		return h.Config.VersionColumn
+	}
+	return ""
+}
+
+// versionExpr is the row version as text, qualified with src in grid statements, or ""
+// when rows have no version: version_column is not a stored column, or there is none and
+// the source is not known to be a table (see resolveVersion).
+func (h *Handler) versionExpr(qualified bool) string {
+	vc := h.versionColumn()
+	switch {
+	case vc != "" && qualified:
+		return "(" + h.columnExpr(vc) + ")::text"
+	case vc != "":
+		return quote_ident(vc) + "::text"
+	case h.Config.VersionColumn != "":
+		return ""
+	}
+	h.versionMu.Lock()
+	xmin := h.versionKind == versionXmin
+	h.versionMu.Unlock()
+	switch {
+	case !xmin:
+		return ""
+	case qualified:
+		return "src.xmin::text"
+	}
+	return "xmin::text"
+}
+
+// versionBump returns the SET item advancing an integer or timestamp version column, ""
+// when the column is maintained by the database (trigger) or rows use xmin.
+func (h *Handler) versionBump() string {
+	vc := h.versionColumn()
+	if vc == "" {
+		return ""
+	}
+	col, _ := h.storedColumn(vc)
+	t := strings.ToLower(col.Type)
+	switch {
+	case strings.Contains(t, "int") || strings.Contains(t, "serial") || t == "numeric":
+		return fmt.Sprintf("%s = %s + 1", quote_ident(vc), quote_ident(vc))
+	case strings.HasPrefix(t, "timestamp"):
+		return fmt.Sprintf("%s = clock_timestamp()", quote_ident(vc))
+	}
+	return ""
+}
+
+// cellEditable reports whether field can be edited in place under access: a stored,
+// unrestricted column that is neither a key nor the version column.
+func (h *Handler) cellEditable(field string, access columnAccess) bool {
+	if _, stored := h.storedColumn(field); !stored || access.restricted(field) || field == h.versionColumn() {
+		return false
+	}
+	for _, pk := range h.primaryKeys() {
+		if pk.Name == field {
+			return false
+		}
+	}
+	return true
+}
+
+// UpdateCellContext sets one column of the row addressed by the primary key values
+// (datagrid.operations.edit), provided the row is still at the version the client read
+// (_version). _field names the column and _value is coerced like a form value of
+// UpdateRowContext. It returns the row with only that column, for the cell partial. On a
+// conflict it returns the current row along with a *ConflictError.
+func (h *Handler) UpdateCellContext(ctx context.Context, values url.Values) (*TableResult, error) {
+	if err := h.allowWrite("edit"); err != nil {
+		return nil, err
+	}
+	if h.resolveVersion(ctx); h.versionExpr(false) == "" {
+		return nil, ErrNoRowVersion
+	}
+	p := RequestParams{version: true}
+	if err := h.resolveAccess(ctx, &p); err != nil {
+		return nil, err
+	}
+
+	verr := &ValidationError{}
+	key := h.rowKey(values, verr)
+	field := values.Get(cellField)
+	col, _ := h.storedColumn(field)
+	if !h.cellEditable(field, p.access) {
+		verr.add(cellField, "column %q cannot be edited", field)
+	}
+	version := values.Get(cellVersion)
+	if version == "" {
+		verr.add(cellVersion, "row version is required")
+	}
+	var v interface{}
+	if len(verr.Errors) == 0 {
+		var err error
+		if v, err = h.writeValue(col, values[cellValue]); err != nil {
+			verr.add(field, "%s", err.Error())
+		}
+	}
+	if len(verr.Errors) > 0 {
+		return nil, verr
+	}
+
+	tx, err := h.beginQueryTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	sets := []string{quote_ident(field) + " = $1"}
+	if bump := h.versionBump(); bump != "" {
+		sets = append(sets, bump)
+	}
+	where, keyArgs := keyWhere(key, 2)
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s AND %s = $%d", quote_ident(h.TableName),
+		strings.Join(sets, ", "), where, h.versionExpr(false), len(keyArgs)+2)
+	args := append(append([]interface{}{v}, keyArgs...), version)
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, h.writeError(ctx, "update", query, err)
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	// Read the row back: the new value, or on a conflict the one that won
+	p.rowKey = key
+	query, configJSON, _, err := h.buildGridSQL(p)
+	if err != nil {
+		return nil, err
+	}
+	records, err := h.runStatement(ctx, tx, query, configJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read written row: %w", h.queryError(ctx, err))
+	}
+	if len(records) == 0 && updated > 0 {
+		return nil, ErrRowNotVisible
+	}
+	if len(records) == 0 {
+		return nil, ErrRowNotFound
+	}
+	current := records[0][field]
+	h.decorateRecords(records)
+
+	result := h.newTableResult(records, 1, p)
+	cols := result.UIColumns
+	result.UIColumns = nil
+	for _, c := range cols {
+		if c.Field == field {
+			result.UIColumns = append(result.UIColumns, c)
+		}
+	}
+	if updated == 0 {
+		rowVersion, _ := records[0]["_version"].(string)
+		return result, &ConflictError{Field: field, Value: current, Version: rowVersion}
+	}
+	return result, tx.Commit()
+}
+
+// ServeCell is the inline edit endpoint (Handler.CellEndpoint). It applies
+// UpdateCellContext and responds with the re-rendered <td> (template "datagrid_cells")
+// and the row's new version in the X-Row-Version header. A conflict is answered with 409,
+// the cell showing the current server value and X-Current-Value carrying it as
+// URL-escaped JSON; other failures as in ServeRow.
+func (h *Handler) ServeCell(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodPatch {
+		w.Header().Set("Allow", "POST, PUT, PATCH")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.UpdateCellContext(r.Context(), r.Form)
+	status := http.StatusOK
+	var cerr *ConflictError
+	if errors.As(err, &cerr) {
+		status = http.StatusConflict
+		if b, jerr := json.Marshal(cerr.Value); jerr == nil {
+			w.Header().Set("X-Current-Value", url.PathEscape(string(b)))
+		}
+	} else if err != nil {
+		writeStatusError(w, r, err)
+		return
+	}
+
+	tmpl, err := template.New("datagrid_cells").Funcs(TemplateFuncs()).ParseFS(UIAssets,
+		"ui/templates/partials/datagrid/table.html",
+	)
+	if err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if v, ok := res.Records[0]["_version"].(string); ok {
+		w.Header().Set("X-Row-Version", v)
+	}
+	w.WriteHeader(status)
+	if err := tmpl.ExecuteTemplate(w, "datagrid_cells", res); err != nil {
+		slog.Error("datagrid render error", "error", err)
+	}
+}
@@ -0,0 +1,92 @@
+package datagrid
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const editCatalog = `{
+	"version": "2.0",
+	"title": "People",
+	"objects": [{"name": "app.people_v", "columns": [
+		{"name": "id", "type": "integer", "primary_key": true},
+		{"name": "name", "type": "text"},
+		{"name": "updated_at", "type": "timestamptz"}
+	]}],
+	"datagrid": {
+		"operations": {"add": true, "edit": true},
+		"columns": {"id": {}, "name": {}, "updated_at": {}}
+	}
+}`
+
+func editHandler(t *testing.T, versionColumn string) *Handler {
+	t.Helper()
+	data := editCatalog
+	if versionColumn != "" {
+		data = strings.Replace(data, `"operations"`, `"version_column": "`+versionColumn+`", "operations"`, 1)
+	}
+	h, err := NewHandlerFromData(nil, []byte(data), "en")
+	if err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	h.CellEndpoint = "/cell"
+	return h
+}
+
+func TestRowVersionWithoutDB(t *testing.T) {
+	h := editHandler(t, "")
+	h.resolveVersion(context.Background()) // no DB: must neither panic nor fail
+
+	if h.inlineEdit() {
+		t.Error("inline edit enabled without a row version")
+	}
+	query, _, _, err := h.buildGridSQL(RequestParams{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(query, "_version") || strings.Contains(query, "xmin") {
+		t.Errorf("grid statement projects a version it cannot resolve:\n%s", query)
+	}
+	_, err = h.UpdateCellContext(context.Background(), url.Values{"id": {"1"}, cellField: {"name"}, cellValue: {"x"}, cellVersion: {"1"}})
+	if !errors.Is(err, ErrNoRowVersion) {
+		t.Errorf("cell update err = %v, want ErrNoRowVersion", err)
+	}
+}
+
+func TestRowVersionColumn(t *testing.T) {
+	h := editHandler(t, "updated_at")
+	if !h.inlineEdit() {
+		t.Fatal("inline edit disabled with a version column")
+	}
+	query, _, _, err := h.buildGridSQL(RequestParams{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(query, `(src."updated_at")::text`) {
+		t.Errorf("grid statement does not project the version column:\n%s", query)
+	}
+	if got, want := h.versionBump(), `"updated_at" = clock_timestamp()`; got != want {
+		t.Errorf("version bump = %s, want %s", got, want)
+	}
+}
+
+func TestRowVersionUnknownColumn(t *testing.T) {
+	h := editHandler(t, "nosuch")
+	if h.inlineEdit() || h.versionExpr(true) != "" {
+		t.Error("an unknown version_column fell back to a version")
+	}
+}
+
+func TestRowVersionXmin(t *testing.T) {
+	h := editHandler(t, "")
+	h.versionKind = versionXmin
+	if got := h.versionExpr(true); got != "src.xmin::text" {
+		t.Errorf("version = %s, want src.xmin::text", got)
+	}
+	if !h.inlineEdit() {
+		t.Error("inline edit disabled on a table")
+	}
+}
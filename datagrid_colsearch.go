@@ -0,0 +1,101 @@
+package datagrid
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// columnSearchPrefix marks the per-column search boxes: search.<field>=value.
+const columnSearchPrefix = "search."
+
+// compileColumnSearch adds the per-column searches (RequestParams.ColumnSearch), AND-ed,
+// each matched according to the column type: codes (LOV and text key columns) and dates
+// by prefix, numbers and booleans exactly, other columns with a case-insensitive
+// "contains". Unknown fields are ignored.
+func (h *Handler) compileColumnSearch(b *whereBuilder, searches map[string]string) {
+	fields := make([]string, 0, len(searches))
+	for f := range searches {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		v := strings.TrimSpace(searches[field])
+		col, ok := h.uiColumn(field)
+		if !ok || v == "" {
+			continue
+		}
+		expr := h.columnExpr(field)
+		t := strings.ToLower(col.Type)
+
+		switch {
+		case t == "boolean" || t == "bool" || t == "int_bool":
+			val, err := strconv.ParseBool(v)
+			if err != nil {
+				b.add("false")
+				continue
+			}
+			if t == "int_bool" {
+				n := 0
+				if val {
+					n = 1
+				}
+				b.add(fmt.Sprintf("%s = %s", expr, b.bind(n, "integer")))
+				continue
+			}
+			b.add(fmt.Sprintf("%s = %s", expr, b.bind(val, "boolean")))
+		case len(col.LOV) > 0 || h.isCodeColumn(field, t):
+			b.add(fmt.Sprintf("(%s)::text ILIKE %s", expr, b.bind(likeEscaper.Replace(v)+"%", "text")))
+		case isNumericType(t):
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				b.add("false") // nothing numeric equals it
+				continue
+			}
+			b.add(fmt.Sprintf("%s = %s", expr, b.bind(v, "numeric")))
+		case strings.HasPrefix(t, "date") || strings.HasPrefix(t, "timestamp"):
+			b.add(fmt.Sprintf("(%s)::text LIKE %s", expr, b.bind(likeEscaper.Replace(v)+"%", "text")))
+		default:
+			b.add(fmt.Sprintf("(%s)::text ILIKE %s", expr, b.bind("%"+likeEscaper.Replace(v)+"%", "text")))
+		}
+	}
+}
+
+// isCodeColumn reports whether a column holds codes rather than free text: a non-numeric
+// primary key or a column declared with type "code".
+func (h *Handler) isCodeColumn(field, colType string) bool {
+	if colType == "code" {
+		return true
+	}
+	if isNumericType(colType) || len(h.Catalog.Objects) == 0 {
+		return false
+	}
+	for _, c := range h.Catalog.Objects[0].Columns {
+		if c.Name == field {
+			return c.PrimaryKey
+		}
+	}
+	return false
+}
+
+func (h *Handler) uiColumn(field string) (UIColumn, bool) {
+	for _, c := range h.Columns {
+		if c.Field == field {
+			return c, true
+		}
+	}
+	return UIColumn{}, false
+}
+
+// activeColumnSearches returns the column searches the request applied, for the
+// template to keep the boxes filled in.
+func (h *Handler) activeColumnSearches(searches map[string]string) map[string]string {
+	active := make(map[string]string, len(searches))
+	for f, v := range searches {
+		if _, ok := h.uiColumn(f); ok && strings.TrimSpace(v) != "" {
+			active[f] = v
+		}
+	}
+	return active
+}
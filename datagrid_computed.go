@@ -0,0 +1,185 @@
+package datagrid
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// mergeVirtualColumns copies the "expr" and "path" of datagrid.columns overrides onto the
+// main object's columns, appending computed and JSON columns the object does not list
+// (sorted by name).
+func mergeVirtualColumns(cat *Catalog) {
+	obj := &cat.Objects[0]
+	listed := make(map[string]int, len(obj.Columns))
+	for i, col := range obj.Columns {
+		listed[col.Name] = i
+	}
+
+	var names []string
+	for name, def := range cat.Datagrid.Columns {
+		if def.Expr != "" || def.Path != "" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		def := cat.Datagrid.Columns[name]
+		if i, ok := listed[name]; ok {
+			obj.Columns[i].Expr, obj.Columns[i].Path = def.Expr, def.Path
+			if obj.Columns[i].Type == "" {
+				obj.Columns[i].Type = def.Type
+			}
+			continue
+		}
+		obj.Columns = append(obj.Columns, ColumnDef{Name: name, Type: def.Type, Labels: def.Labels, Expr: def.Expr, Path: def.Path})
+	}
+}
+
+// Words a computed column expression may use besides column names.
+var (
+	exprKeywords = map[string]bool{
+		"and": true, "or": true, "not": true, "is": true, "null": true, "true": true, "false": true,
+		"case": true, "when": true, "then": true, "else": true, "end": true,
+		"between": true, "in": true, "like": true, "ilike": true, "distinct": true, "from": true,
+	}
+	exprFunctions = map[string]bool{
+		"abs": true, "round": true, "ceil": true, "floor": true, "trunc": true, "sqrt": true,
+		"power": true, "mod": true, "sign": true, "greatest": true, "least": true,
+		"coalesce": true, "nullif": true, "lower": true, "upper": true, "trim": true,
+		"initcap": true, "length": true, "concat": true, "concat_ws": true, "left": true,
+		"right": true, "replace": true, "split_part": true, "substr": true, "to_char": true,
+		"date_part": true, "date_trunc": true, "age": true, "now": true,
+	}
+	exprCasts = map[string]bool{
+		"integer": true, "int": true, "bigint": true, "smallint": true, "numeric": true,
+		"decimal": true, "real": true, "float8": true, "text": true, "varchar": true,
+		"date": true, "timestamp": true, "timestamptz": true, "boolean": true, "interval": true,
+	}
+)
+
+// compileExpr checks a computed column expression and rewrites its column references to
+// their SQL (see columnExpr). Only numbers, string literals, operators, the keywords and
+// functions above and known stored or lookup columns are accepted, so the catalog cannot
+// smuggle arbitrary SQL into the statements.
+func (h *Handler) compileExpr(expr string) (string, error) {
+	var out []string
+	prev, depth := "", 0
+	rs := []rune(expr)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+
+		case unicode.IsDigit(r) || r == '.' && i+1 < len(rs) && unicode.IsDigit(rs[i+1]):
+			j := i
+			for j < len(rs) && (unicode.IsDigit(rs[j]) || rs[j] == '.') {
+				j++
+			}
+			prev = string(rs[i:j])
+			i = j
+
+		case r == '\'':
+			j := i + 1
+			for ; j < len(rs); j++ {
+				if rs[j] == '\'' {
+					if j+1 < len(rs) && rs[j+1] == '\'' {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(rs) {
+				return "", fmt.Errorf("unterminated string in expression %q", expr)
+			}
+			prev = string(rs[i : j+1])
+			i = j + 1
+
+		case r == '"':
+			j := i + 1
+			for j < len(rs) && rs[j] != '"' {
+				j++
+			}
+			if j >= len(rs) {
+				return "", fmt.Errorf("unterminated identifier in expression %q", expr)
+			}
+			name := string(rs[i+1 : j])
+			col, ok := h.columnExprs[name]
+			if !ok {
+				return "", fmt.Errorf("unknown column %q in expression", name)
+			}
+			prev = col
+			i = j + 1
+
+		case r == '_' || unicode.IsLetter(r):
+			j := i
+			for j < len(rs) && (rs[j] == '_' || unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j])) {
+				j++
+			}
+			word := string(rs[i:j])
+			lower := strings.ToLower(word)
+			k := j
+			for k < len(rs) && unicode.IsSpace(rs[k]) {
+				k++
+			}
+			call := k < len(rs) && rs[k] == '('
+
+			switch {
+			case prev == "::":
+				if !exprCasts[lower] {
+					return "", fmt.Errorf("unsupported cast %q in expression", word)
+				}
+				prev = lower
+			case call && exprFunctions[lower]:
+				prev = strings.ToUpper(lower)
+			case exprKeywords[lower] || lower == "current_date":
+				prev = strings.ToUpper(lower)
+			default:
+				col, ok := h.columnExprs[word]
+				if !ok {
+					return "", fmt.Errorf("unknown column %q in expression", word)
+				}
+				prev = col
+			}
+			i = j
+
+		default:
+			op := ""
+			for _, o := range []string{"::", "||", "<=", ">=", "<>", "!=", "+", "-", "*", "/", "%", "(", ")", ",", "<", ">", "="} {
+				if strings.HasPrefix(string(rs[i:]), o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return "", fmt.Errorf("unexpected %q in expression %q", r, expr)
+			}
+			if (op == "-" || op == "/") && i+1 < len(rs) && rs[i+1] == rs[i] || op == "/" && i+1 < len(rs) && rs[i+1] == '*' {
+				return "", fmt.Errorf("comments are not allowed in expression %q", expr)
+			}
+			switch op {
+			case "(":
+				depth++
+			case ")":
+				if depth--; depth < 0 {
+					return "", fmt.Errorf("unbalanced parentheses in expression %q", expr)
+				}
+			}
+			prev = op
+			i += len(op)
+		}
+		out = append(out, prev)
+	}
+	if len(out) == 0 {
+		return "", fmt.Errorf("empty expression")
+	}
+	if depth != 0 {
+		return "", fmt.Errorf("unbalanced parentheses in expression %q", expr)
+	}
+	return strings.Join(out, " "), nil
+}
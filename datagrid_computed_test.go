@@ -0,0 +1,93 @@
+package datagrid
+
+import (
+	"strings"
+	"testing"
+)
+
+func computedHandler() *Handler {
+	return &Handler{columnExprs: map[string]string{
+		"price":    `src."price"`,
+		"qty":      `src."qty"`,
+		"name":     `src."name"`,
+		"hired":    `src."hired"`,
+		"Unit Net": `src."Unit Net"`,
+		"cat_name": `j1."name"`,
+	}}
+}
+
+func TestCompileExpr(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"price * qty", `src."price" * src."qty"`},
+		{"price+qty*2", `src."price" + src."qty" * 2`},
+		{"(price + qty) * 2", `( src."price" + src."qty" ) * 2`},
+		{"price * -1.5", `src."price" * - 1.5`},
+		{"price * .5", `src."price" * .5`},
+		{"price % 3 - qty / 2", `src."price" % 3 - src."qty" / 2`},
+		{"round(price::numeric, 2)", `ROUND ( src."price" :: numeric , 2 )`},
+		{"qty::INT", `src."qty" :: int`},
+		{"name || ' (' || cat_name || ')'", `src."name" || ' (' || j1."name" || ')'`},
+		{"'it''s ' || name", `'it''s ' || src."name"`},
+		{"'price; DROP TABLE t; --'", `'price; DROP TABLE t; --'`},
+		{`"Unit Net" * qty`, `src."Unit Net" * src."qty"`},
+		{"CASE WHEN qty > 0 THEN price / qty ELSE NULL END", `CASE WHEN src."qty" > 0 THEN src."price" / src."qty" ELSE NULL END`},
+		{"coalesce (name, 'n/a')", `COALESCE ( src."name" , 'n/a' )`},
+		{"qty BETWEEN 1 AND 5 OR price IS NOT NULL", `src."qty" BETWEEN 1 AND 5 OR src."price" IS NOT NULL`},
+		{"current_date - hired", `CURRENT_DATE - src."hired"`},
+		{"date_part('year', age(hired))", `DATE_PART ( 'year' , AGE ( src."hired" ) )`},
+		{"price <> qty AND price <= 10", `src."price" <> src."qty" AND src."price" <= 10`},
+	}
+	h := computedHandler()
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := h.compileExpr(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("compiled = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileExprErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"", "empty expression"},
+		{"salary * 2", `unknown column "salary"`},
+		{`"salary" * 2`, `unknown column "salary"`},
+		{"'open", "unterminated string"},
+		{`"open`, "unterminated identifier"},
+		{"(price + qty", "unbalanced parentheses"},
+		{"price + qty)", "unbalanced parentheses"},
+		{"qty::regclass", `unsupported cast "regclass"`},
+		{"pg_sleep(10)", `unknown column "pg_sleep"`},
+		{"price; DROP TABLE t", `unexpected ';'`},
+		{"price -- comment", "comments are not allowed"},
+		{"price /* comment */", "comments are not allowed"},
+		{"$$x$$", `unexpected '$'`},
+		{"price FROM pg_shadow", `unknown column "pg_shadow"`},
+		{"(SELECT 1)", `unknown column "SELECT"`},
+		{`"price"" OR 1=1 --" * 2`, `unknown column " OR 1=1 --"`},
+		{"E'\\x41'", `unknown column "E"`},
+		{"price[1]", `unexpected '['`},
+	}
+	h := computedHandler()
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := h.compileExpr(tt.expr)
+			if err == nil {
+				t.Fatalf("compiled to %s, want error %q", got, tt.err)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package datagrid
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ConstantResolver computes a server-side constant from the request context, e.g. the
+// logged-in user or the tenant. It backs constant:<key> parameters and :<key> placeholders
+// in report and LOV SQL. Supported values: string, integers, float64, bool, time.Time,
+// []string and []int64 (bound as arrays); nil binds as NULL.
+type ConstantResolver func(ctx context.Context) (interface{}, error)
+
+var (
+	constantsMu       sync.RWMutex
+	constantResolvers = map[string]ConstantResolver{
+		"now_utc": func(context.Context) (interface{}, error) { return time.Now().UTC(), nil },
+	}
+)
+
+// RegisterConstant registers the process-wide resolver for key (current_user, current_roles,
+// tenant_id, user_department, ...), replacing any previous one. Handler.Constants takes
+// precedence for a single handler.
+func RegisterConstant(key string, fn ConstantResolver) {
+	constantsMu.Lock()
+	defer constantsMu.Unlock()
+	constantResolvers[key] = fn
+}
+
+type constantsKey struct{}
+
+// WithConstants returns a context carrying constant values, for hosts that resolve the
+// user once in a middleware instead of registering resolvers. Values already carried by
+// ctx are kept unless overridden.
+func WithConstants(ctx context.Context, values map[string]interface{}) context.Context {
+	merged := make(map[string]interface{})
+	if prev, ok := ctx.Value(constantsKey{}).(map[string]interface{}); ok {
+		for k, v := range prev {
+			merged[k] = v
+		}
+	}
+	for k, v := range values {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, constantsKey{}, merged)
+}
+
+// resolveConstant looks key up in Handler.Constants, the registry, the context values and
+// finally the built-in current_user (Handler.CurrentUser). ok is false for unknown keys.
+func (h *Handler) resolveConstant(ctx context.Context, key string) (v interface{}, ok bool, err error) {
+	fn, found := h.Constants[key]
+	if !found {
+		constantsMu.RLock()
+		fn, found = constantResolvers[key]
+		constantsMu.RUnlock()
+	}
+	if found {
+		v, err = fn(ctx)
+		if err != nil {
+			return nil, true, fmt.Errorf("constant %s: %w", key, err)
+		}
+		return v, true, nil
+	}
+	if values, isMap := ctx.Value(constantsKey{}).(map[string]interface{}); isMap {
+		if v, found := values[key]; found {
+			return v, true, nil
+		}
+	}
+	if key == "current_user" {
+		return h.CurrentUser, true, nil
+	}
+	return nil, false, nil
+}
+
+// constantArg converts a resolved constant into a driver argument.
+func constantArg(v interface{}) interface{} {
+	switch val := v.(type) {
+	case []string:
+		return pq.Array(val)
+	case []int64:
+		return pq.Array(val)
+	case []int:
+		ints := make([]int64, len(val))
+		for i, n := range val {
+			ints[i] = int64(n)
+		}
+		return pq.Array(ints)
+	}
+	return v
+}
+
+// constantCastType is the placeholder cast for an undeclared constant, by its Go type.
+func constantCastType(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "text"
+	case []string:
+		return "text[]"
+	case int, int32, int64:
+		return "bigint"
+	case []int, []int64:
+		return "bigint[]"
+	case float64:
+		return "float8"
+	case bool:
+		return "boolean"
+	case time.Time:
+		return "timestamptz"
+	}
+	return ""
+}
+
+// referencesConstants reports whether the parameter's LOV query uses a server-side
+// constant, so its options can only be resolved with a request context.
+func (h *Handler) referencesConstants(p QueryParam) bool {
+	lovSQL := p.resolvedLOVQuery()
+	if lovSQL == "" {
+		return false
+	}
+	_, names := rewriteNamedParams(lovSQL, 1, func(string) string { return "" }, h.isQueryParam)
+	for _, name := range names {
+		other, _, ok := findParam(h.QueryParams, name)
+		if !ok || other.InputType() == "constant" {
+			return true
+		}
+	}
+	return false
+}
+
+// optionsPerRequest reports whether the options of a LOV parameter depend on who asks:
+// its query uses a constant, or reads a session setting that takes a constant (see
+// readsSessionSettings). Other LOVs are shared and loaded once with the catalog.
+func (h *Handler) optionsPerRequest(p QueryParam) bool {
+	return h.referencesConstants(p) || h.readsSessionSettings(p.resolvedLOVQuery())
+}
+
+// readsSessionSettings reports whether query mentions current_setting or the name of a
+// session setting taken from a constant, e.g. current_setting('app.tenant', true).
+// Matching is textual and case-insensitive, so it errs on the side of per-request loading.
+func (h *Handler) readsSessionSettings(query string) bool {
+	if query == "" {
+		return false
+	}
+	lower := strings.ToLower(query)
+	if strings.Contains(lower, "current_setting") {
+		return true
+	}
+	for _, s := range h.sessionSettings() {
+		name := strings.ToLower(strings.TrimSpace(s.Name))
+		if s.Constant != "" && name != "" && name != "role" && strings.Contains(lower, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryParamsContext returns a copy of the query parameters in which the options of LOV
+// parameters that depend on the requester (see optionsPerRequest: a server-side constant
+// such as :current_user in the query, or a session setting from a constant) are resolved
+// with the constants of ctx, all in one transaction. Handler.QueryParams is left as is, so
+// concurrent requests of different users or tenants never see each other's options. Call
+// it only when the parameter form is rendered, not for result pages.
+func (h *Handler) QueryParamsContext(ctx context.Context) []QueryParam {
+	params := append([]QueryParam(nil), h.QueryParams...)
+	var tx *sql.Tx
+	defer func() {
+		if tx != nil {
+			tx.Rollback()
+		}
+	}()
+	for i := range params {
+		if !isLOVInput(params[i].InputType()) || !h.optionsPerRequest(params[i]) {
+			continue
+		}
+		if tx == nil {
+			var err error
+			if tx, err = h.beginQueryTx(ctx); err != nil {
+				slog.Error("LOV query error for param", "name", params[i].Name, "error", err)
+				return params
+			}
+		}
+		opts, err := h.queryParamOptions(ctx, tx, params[i], nil)
+		if err != nil {
+			// The failed statement aborted the transaction; the next LOV opens a new one
+			slog.Error("LOV query error for param", "name", params[i].Name, "error", err)
+			tx.Rollback()
+			tx = nil
+			continue
+		}
+		params[i].Options = opts
+	}
+	return params
+}
+
+// LoadConstantOptions stores the options of QueryParamsContext in Handler.QueryParams. It
+// changes the handler, so it is only meant for handlers built for a single user
+// (NewHandlerFromDataWithUser); handlers shared between requests use QueryParamsContext.
+func (h *Handler) LoadConstantOptions(ctx context.Context) {
+	h.QueryParams = h.QueryParamsContext(ctx)
+}
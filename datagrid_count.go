@@ -0,0 +1,149 @@
+package datagrid
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Count modes (datagrid.count_mode), reported back in TableResult.CountMode.
+const (
+	countExact    = "exact"    // SELECT COUNT(*) over the filtered rows
+	countEstimate = "estimate" // planner estimate (pg_class.reltuples when unfiltered)
+	countCapped   = "capped"   // exact up to count_cap rows, then "N+"
+	countNone     = "none"     // no count; the pager only knows whether more rows follow
+)
+
+const defaultCountCap = 1000
+
+// rowCount is the outcome of counting the filtered rows.
+type rowCount struct {
+	Total int
+	Mode  string
+	More  bool // capped: more than Total rows match
+}
+
+// countMode returns the configured count mode, defaulting to exact.
+func (h *Handler) countMode() string {
+	switch m := strings.ToLower(strings.TrimSpace(h.Config.CountMode)); m {
+	case countEstimate, countCapped, countNone:
+		return m
+	}
+	return countExact
+}
+
+func (h *Handler) countCap() int {
+	if h.Config.CountCap > 0 {
+		return h.Config.CountCap
+	}
+	return defaultCountCap
+}
+
+// countRows counts the rows of source (a FROM item aliased src) matching where, as the
+// catalog's count mode prescribes. relation names the table for the pg_class shortcut of
+// unfiltered estimates; it is "" for query sources.
+func (h *Handler) countRows(ctx context.Context, tx *sql.Tx, source, where, relation string, args ...interface{}) (rowCount, error) {
+	mode := h.countMode()
+	rc := rowCount{Mode: mode}
+
+	var query string
+	switch mode {
+	case countNone:
+		return rc, nil
+	case countEstimate:
+		if where == "" && relation != "" {
+			var n sql.NullFloat64
+			err := tx.QueryRowContext(ctx, "SELECT reltuples FROM pg_class WHERE oid = to_regclass($1)", relation).Scan(&n)
+			if err != nil && err != sql.ErrNoRows {
+				return rc, h.queryError(ctx, err)
+			}
+			if n.Valid && n.Float64 > 0 { // -1 / 0: never analyzed, ask the planner
+				rc.Total = int(n.Float64)
+				return rc, nil
+			}
+		}
+		var plan string
+		query = fmt.Sprintf("EXPLAIN (FORMAT JSON) SELECT 1 FROM %s %s", source, where)
+		if err := tx.QueryRowContext(ctx, query, args...).Scan(&plan); err != nil {
+			return rc, h.countError(ctx, query, err)
+		}
+		var explain []struct {
+			Plan struct {
+				Rows float64 `json:"Plan Rows"`
+			} `json:"Plan"`
+		}
+		if err := json.Unmarshal([]byte(plan), &explain); err != nil || len(explain) == 0 {
+			return rc, fmt.Errorf("failed to read row estimate: %v", err)
+		}
+		rc.Total = int(explain[0].Plan.Rows)
+		return rc, nil
+	case countCapped:
+		limit := h.countCap()
+		query = fmt.Sprintf("SELECT COUNT(*) FROM (SELECT 1 FROM %s %s LIMIT %d) AS capped", source, where, limit+1)
+		if err := tx.QueryRowContext(ctx, query, args...).Scan(&rc.Total); err != nil {
+			return rc, h.countError(ctx, query, err)
+		}
+		if rc.Total > limit {
+			rc.Total, rc.More = limit, true
+		}
+		return rc, nil
+	}
+
+	query = fmt.Sprintf("SELECT COUNT(*) FROM %s %s", source, where)
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(&rc.Total); err != nil {
+		return rc, h.countError(ctx, query, err)
+	}
+	return rc, nil
+}
+
+func (h *Handler) countError(ctx context.Context, query string, err error) error {
+	if os.Getenv("DEBUG_SQL") == "true" {
+		fmt.Printf("--- COUNT QUERY ERROR ---\nQuery: %s\nError: %v\n------------------------\n", query, err)
+	}
+	return fmt.Errorf("failed to count rows: %w", h.queryError(ctx, err))
+}
+
+// countLabel formats TableResult.TotalCount for the pager: "1,234", "~1.2M" for
+// estimates, "1,000+" when capped, "more…" when uncounted rows follow.
+func countLabel(res *TableResult) string {
+	switch res.CountMode {
+	case countEstimate:
+		n := float64(res.TotalCount)
+		switch {
+		case n >= 1e6:
+			return fmt.Sprintf("~%.1fM", n/1e6)
+		case n >= 1e3:
+			return fmt.Sprintf("~%.1fk", n/1e3)
+		}
+		return "~" + groupThousands(res.TotalCount)
+	case countCapped:
+		if res.CountMore {
+			return groupThousands(res.TotalCount) + "+"
+		}
+	case countNone:
+		if res.CountMore {
+			return "more…"
+		}
+	}
+	return groupThousands(res.TotalCount)
+}
+
+func groupThousands(n int) string {
+	s := fmt.Sprintf("%d", n)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	if neg {
+		return "-" + b.String()
+	}
+	return b.String()
+}
@@ -0,0 +1,187 @@
+package datagrid
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCountMode(t *testing.T) {
+	tests := []struct {
+		config string
+		want   string
+	}{
+		{"", countExact},
+		{"exact", countExact},
+		{"estimate", countEstimate},
+		{" Capped ", countCapped},
+		{"NONE", countNone},
+		{"approximate", countExact},
+	}
+	for _, tt := range tests {
+		h := &Handler{Config: DatagridConfig{CountMode: tt.config}}
+		if got := h.countMode(); got != tt.want {
+			t.Errorf("countMode(%q) = %s, want %s", tt.config, got, tt.want)
+		}
+	}
+
+	if got := (&Handler{}).countCap(); got != defaultCountCap {
+		t.Errorf("default cap = %d, want %d", got, defaultCountCap)
+	}
+	if got := (&Handler{Config: DatagridConfig{CountCap: 50}}).countCap(); got != 50 {
+		t.Errorf("cap = %d, want 50", got)
+	}
+}
+
+func TestCountLabel(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  string
+		total int
+		more  bool
+		want  string
+	}{
+		{"exact", countExact, 1234567, false, "1,234,567"},
+		{"exact small", countExact, 7, false, "7"},
+		{"no mode", "", 1000, false, "1,000"},
+		{"estimate zero", countEstimate, 0, false, "~0"},
+		{"estimate units", countEstimate, 999, false, "~999"},
+		{"estimate thousands", countEstimate, 1000, false, "~1.0k"},
+		{"estimate thousands rounded", countEstimate, 45678, false, "~45.7k"},
+		{"estimate millions", countEstimate, 1234567, false, "~1.2M"},
+		{"capped over", countCapped, 1000, true, "1,000+"},
+		{"capped under", countCapped, 37, false, "37"},
+		{"none with more", countNone, 50, true, "more…"},
+		{"none on the last page", countNone, 42, false, "42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &TableResult{TotalCount: tt.total, CountMode: tt.mode, CountMore: tt.more}
+			if got := countLabel(res); got != tt.want {
+				t.Errorf("countLabel = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupThousands(t *testing.T) {
+	for n, want := range map[int]string{0: "0", 999: "999", 1000: "1,000", 100000: "100,000", -1234: "-1,234", -999: "-999"} {
+		if got := groupThousands(n); got != want {
+			t.Errorf("groupThousands(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
+
+func TestCountRowsNone(t *testing.T) {
+	h := &Handler{Config: DatagridConfig{CountMode: countNone}}
+	// No statement may run (tx is nil): the pager learns about further rows from the probe row
+	rc, err := h.countRows(context.Background(), nil, `"app"."t" AS src`, "WHERE src.x = $1", `"app"."t"`, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc != (rowCount{Mode: countNone}) {
+		t.Errorf("count = %+v, want none with no total", rc)
+	}
+}
+
+// countStub is a database/sql driver answering a statement with one row, the value of
+// the answers key found in its text, or with no rows when no key matches.
+type countStub struct{ answers map[string]driver.Value }
+
+var countStubs = map[string]*countStub{}
+
+func init() { sql.Register("countstub", countStubDriver{}) }
+
+type countStubDriver struct{}
+
+func (countStubDriver) Open(name string) (driver.Conn, error) { return countStubs[name], nil }
+
+func (c *countStub) Prepare(query string) (driver.Stmt, error) { return countStubStmt{c, query}, nil }
+func (c *countStub) Close() error                              { return nil }
+func (c *countStub) Begin() (driver.Tx, error)                 { return c, nil }
+func (c *countStub) Commit() error                             { return nil }
+func (c *countStub) Rollback() error                           { return nil }
+
+type countStubStmt struct {
+	c     *countStub
+	query string
+}
+
+func (s countStubStmt) Close() error  { return nil }
+func (s countStubStmt) NumInput() int { return -1 }
+func (s countStubStmt) Exec([]driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+func (s countStubStmt) Query([]driver.Value) (driver.Rows, error) {
+	for key, v := range s.c.answers {
+		if strings.Contains(s.query, key) {
+			return &countStubRows{v: v}, nil
+		}
+	}
+	return &countStubRows{done: true}, nil
+}
+
+type countStubRows struct {
+	v    driver.Value
+	done bool
+}
+
+func (r *countStubRows) Columns() []string { return []string{"n"} }
+func (r *countStubRows) Close() error      { return nil }
+func (r *countStubRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	dest[0], r.done = r.v, true
+	return nil
+}
+
+func TestCountRowsModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  DatagridConfig
+		where   string
+		answers map[string]driver.Value
+		total   int
+		more    bool
+		label   string
+	}{
+		{"exact", DatagridConfig{}, "WHERE x", map[string]driver.Value{"SELECT COUNT(*) FROM": int64(1234)}, 1234, false, "1,234"},
+		{"capped over", DatagridConfig{CountMode: countCapped, CountCap: 100}, "WHERE x", map[string]driver.Value{"LIMIT 101) AS capped": int64(101)}, 100, true, "100+"},
+		{"capped under", DatagridConfig{CountMode: countCapped, CountCap: 100}, "WHERE x", map[string]driver.Value{"LIMIT 101) AS capped": int64(37)}, 37, false, "37"},
+		{"estimate unfiltered", DatagridConfig{CountMode: countEstimate}, "", map[string]driver.Value{"FROM pg_class": 1234567.0}, 1234567, false, "~1.2M"},
+		{"estimate never analyzed", DatagridConfig{CountMode: countEstimate}, "", map[string]driver.Value{"FROM pg_class": -1.0, "EXPLAIN": `[{"Plan": {"Plan Rows": 2500}}]`}, 2500, false, "~2.5k"},
+		{"estimate filtered", DatagridConfig{CountMode: countEstimate}, "WHERE x", map[string]driver.Value{"FROM pg_class": 1e9, "EXPLAIN (FORMAT JSON) SELECT 1 FROM t AS src WHERE x": `[{"Plan": {"Plan Rows": 42}}]`}, 42, false, "~42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			countStubs[tt.name] = &countStub{answers: tt.answers}
+			db, err := sql.Open("countstub", tt.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+
+			h := &Handler{Config: tt.config}
+			rc, err := h.countRows(context.Background(), tx, "t AS src", tt.where, "t")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rc.Total != tt.total || rc.More != tt.more || rc.Mode != h.countMode() {
+				t.Errorf("count = %+v, want %d (more %v)", rc, tt.total, tt.more)
+			}
+			res := &TableResult{TotalCount: rc.Total, CountMode: rc.Mode, CountMore: rc.More}
+			if got := countLabel(res); got != tt.label {
+				t.Errorf("countLabel = %q, want %q", got, tt.label)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package datagrid
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// DatePreset is a named relative date range, resolved against the current day.
+type DatePreset struct {
+	Key   string
+	Label string
+	From  string // YYYY-MM-DD, inclusive
+	To    string // YYYY-MM-DD, inclusive
+}
+
+// dateRangePresets lists the presets offered by daterange parameters, in display order.
+var dateRangePresets = []DatePreset{
+	{Key: "today", Label: "Today"},
+	{Key: "yesterday", Label: "Yesterday"},
+	{Key: "last_7_days", Label: "Last 7 days"},
+	{Key: "this_week", Label: "This week"},
+	{Key: "this_month", Label: "This month"},
+	{Key: "last_month", Label: "Last month"},
+	{Key: "this_quarter", Label: "This quarter"},
+	{Key: "ytd", Label: "Year to date"},
+	{Key: "previous_year", Label: "Previous year"},
+}
+
+// DateRangeControl is what params_form.html needs to render a daterange parameter.
+type DateRangeControl struct {
+	Preset  string
+	From    string
+	To      string
+	Presets []DatePreset
+}
+
+// resolveDatePreset returns the inclusive bounds of a named preset. Weeks start on Monday.
+func resolveDatePreset(key string, now time.Time) (from, to time.Time, ok bool) {
+	today := truncateDay(now)
+	switch strings.ToLower(strings.TrimSpace(key)) {
+	case "today":
+		return today, today, true
+	case "yesterday":
+		d := today.AddDate(0, 0, -1)
+		return d, d, true
+	case "last_7_days":
+		return today.AddDate(0, 0, -6), today, true
+	case "this_week":
+		start := startOfWeek(today)
+		return start, start.AddDate(0, 0, 6), true
+	case "this_month":
+		start := startOfMonth(today)
+		return start, start.AddDate(0, 1, -1), true
+	case "last_month":
+		start := startOfMonth(today).AddDate(0, -1, 0)
+		return start, start.AddDate(0, 1, -1), true
+	case "this_quarter":
+		start := startOfQuarter(today)
+		return start, start.AddDate(0, 3, -1), true
+	case "ytd":
+		return startOfYear(today), today, true
+	case "previous_year":
+		start := startOfYear(today).AddDate(-1, 0, 0)
+		return start, start.AddDate(1, 0, -1), true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// dateExprPattern matches "<base> [+|- N [unit]]", e.g. "CURRENT_DATE - 30",
+// "start_of_month + 1 week" or "CURRENT_DATE - INTERVAL '1 month'".
+var dateExprPattern = regexp.MustCompile(`(?i)^(\d{4}-\d{2}-\d{2}|[a-z_]+(?:\(\))?)\s*(?:([+-])\s*(?:interval\s*)?'?\s*(\d+)\s*(days?|weeks?|months?|years?)?\s*'?)?$`)
+
+// resolveDateExpr evaluates a date default or bound such as CURRENT_DATE, "CURRENT_DATE - 30",
+// start_of_month or a YYYY-MM-DD literal. A bare offset is in days.
+func resolveDateExpr(expr string, now time.Time) (time.Time, bool) {
+	m := dateExprPattern.FindStringSubmatch(strings.TrimSpace(expr))
+	if m == nil {
+		return time.Time{}, false
+	}
+
+	today := truncateDay(now)
+	var d time.Time
+	switch base := strings.ToLower(m[1]); base {
+	case "current_date", "current_timestamp", "now", "now()", "today":
+		d = today
+	case "yesterday":
+		d = today.AddDate(0, 0, -1)
+	case "tomorrow":
+		d = today.AddDate(0, 0, 1)
+	case "start_of_week":
+		d = startOfWeek(today)
+	case "end_of_week":
+		d = startOfWeek(today).AddDate(0, 0, 6)
+	case "start_of_month":
+		d = startOfMonth(today)
+	case "end_of_month":
+		d = startOfMonth(today).AddDate(0, 1, -1)
+	case "start_of_quarter":
+		d = startOfQuarter(today)
+	case "end_of_quarter":
+		d = startOfQuarter(today).AddDate(0, 3, -1)
+	case "start_of_year":
+		d = startOfYear(today)
+	case "end_of_year":
+		d = startOfYear(today).AddDate(1, 0, -1)
+	default:
+		t, err := time.ParseInLocation(dateLayout, base, now.Location())
+		if err != nil {
+			return time.Time{}, false
+		}
+		d = t
+	}
+
+	if m[2] == "" {
+		return d, true
+	}
+	n, _ := strconv.Atoi(m[3])
+	if m[2] == "-" {
+		n = -n
+	}
+	switch unit := strings.ToLower(m[4]); {
+	case strings.HasPrefix(unit, "week"):
+		d = d.AddDate(0, 0, 7*n)
+	case strings.HasPrefix(unit, "month"):
+		d = addMonths(d, n)
+	case strings.HasPrefix(unit, "year"):
+		d = addMonths(d, 12*n)
+	default:
+		d = d.AddDate(0, 0, n)
+	}
+	return d, true
+}
+
+// resolveDateRangeDefault evaluates a daterange default: a preset key, a "from .. to" pair of
+// date expressions, or a single expression meaning "from then until today".
+func resolveDateRangeDefault(def string, now time.Time) (from, to string) {
+	def = strings.TrimSpace(def)
+	if def == "" || strings.EqualFold(def, "NULL") {
+		return "", ""
+	}
+	if f, t, ok := resolveDatePreset(def, now); ok {
+		return f.Format(dateLayout), t.Format(dateLayout)
+	}
+	lo, hi := def, "CURRENT_DATE"
+	if parts := strings.SplitN(def, "..", 2); len(parts) == 2 {
+		lo, hi = parts[0], parts[1]
+	}
+	if f, ok := resolveDateExpr(lo, now); ok {
+		from = f.Format(dateLayout)
+	}
+	if t, ok := resolveDateExpr(hi, now); ok {
+		to = t.Format(dateLayout)
+	}
+	return from, to
+}
+
+// dateRangeControl resolves the presets and default bounds shown for a daterange parameter.
+func dateRangeControl(p QueryParam) DateRangeControl {
+	now := time.Now()
+	ctl := DateRangeControl{Presets: make([]DatePreset, len(dateRangePresets))}
+	for i, preset := range dateRangePresets {
+		from, to, _ := resolveDatePreset(preset.Key, now)
+		preset.From, preset.To = from.Format(dateLayout), to.Format(dateLayout)
+		ctl.Presets[i] = preset
+	}
+	if _, _, ok := resolveDatePreset(p.Default, now); ok {
+		ctl.Preset = strings.ToLower(strings.TrimSpace(p.Default))
+	}
+	ctl.From, ctl.To = resolveDateRangeDefault(p.Default, now)
+	return ctl
+}
+
+// resolveRange returns the inclusive YYYY-MM-DD bounds of a daterange parameter (either may
+// be empty for an open end). A submitted preset wins over the submitted dates, and the
+// catalog default applies when the parameter was not submitted at all.
+func (p QueryParam) resolveRange(values map[string][]string, now time.Time) (from, to string, err error) {
+	presetVals, hasPreset := values[p.Name]
+	fromVals, hasFrom := values[p.Name+"_from"]
+	toVals, hasTo := values[p.Name+"_to"]
+
+	preset := firstValue(presetVals)
+	switch {
+	case preset != "":
+		f, t, ok := resolveDatePreset(preset, now)
+		if !ok {
+			return "", "", fmt.Errorf("unknown date range preset %q", preset)
+		}
+		return f.Format(dateLayout), t.Format(dateLayout), nil
+	case hasFrom || hasTo:
+		from, to = firstValue(fromVals), firstValue(toVals)
+		for _, v := range []string{from, to} {
+			if v == "" {
+				continue
+			}
+			if _, err := convertParamValue("date", v); err != nil {
+				return "", "", err
+			}
+		}
+		return from, to, nil
+	case !hasPreset:
+		from, to = resolveDateRangeDefault(p.Default, now)
+	}
+	return from, to, nil
+}
+
+// rangeBoundType is the cast for the :name_from, :name_to and :name_before placeholders.
+func (p QueryParam) rangeBoundType() string {
+	switch t := strings.ToLower(strings.TrimSpace(p.Type)); t {
+	case "tstzrange", "timestamptz", "timestamp with time zone":
+		return "timestamptz"
+	case "tsrange", "timestamp", "timestamp without time zone":
+		return "timestamp"
+	}
+	return "date"
+}
+
+// rangeType is the cast for the :name placeholder, bound as a half-open range.
+func (p QueryParam) rangeType() string {
+	switch p.rangeBoundType() {
+	case "timestamptz":
+		return "tstzrange"
+	case "timestamp":
+		return "tsrange"
+	}
+	return "daterange"
+}
+
+// bindRange returns the argument for one placeholder of a daterange parameter: part is
+// "from" (first day, inclusive), "to" (last day, inclusive), "before" (the day after the
+// last, exclusive: compare with <) or "range" ('[from,to+1)'). Cast to a timestamp, "to"
+// is the midnight that starts the last day, so timestamp columns need "before" (or
+// :name_to + 1 day) to include it. Open ends bind as NULL.
+func (p QueryParam) bindRange(part, from, to string) (interface{}, error) {
+	nullable := func(s string) interface{} {
+		if s == "" {
+			return nil
+		}
+		return s
+	}
+	switch part {
+	case "from":
+		return nullable(from), nil
+	case "to":
+		return nullable(to), nil
+	case "before":
+		upper, err := dayAfter(to)
+		return nullable(upper), err
+	}
+	if from == "" && to == "" {
+		return nil, nil
+	}
+	upper, err := dayAfter(to)
+	if err != nil {
+		return nil, err
+	}
+	return "[" + from + "," + upper + ")", nil
+}
+
+// dayAfter returns the YYYY-MM-DD day following day, or "" for an open end.
+func dayAfter(day string) (string, error) {
+	if day == "" {
+		return "", nil
+	}
+	t, err := time.Parse(dateLayout, day)
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q", day)
+	}
+	return t.AddDate(0, 0, 1).Format(dateLayout), nil
+}
+
+// findParam resolves a placeholder name to its parameter. For daterange parameters
+// :name binds the range and :name_from, :name_to and :name_before its bounds; part
+// reports which.
+func findParam(params []QueryParam, name string) (p QueryParam, part string, ok bool) {
+	for _, qp := range params {
+		if qp.InputType() != "daterange" {
+			if qp.Name == name {
+				return qp, "", true
+			}
+			continue
+		}
+		switch name {
+		case qp.Name:
+			return qp, "range", true
+		case qp.Name + "_from":
+			return qp, "from", true
+		case qp.Name + "_to":
+			return qp, "to", true
+		case qp.Name + "_before":
+			return qp, "before", true
+		}
+	}
+	return QueryParam{}, "", false
+}
+
+// isDateDefault reports whether the default is a date expression to resolve, rather than
+// a literal that merely looks like one (e.g. a "today" option of a text select).
+func (p QueryParam) isDateDefault() bool {
+	t := strings.ToLower(strings.TrimSpace(p.Type))
+	return p.InputType() == "date" || strings.HasPrefix(t, "date") || strings.HasPrefix(t, "timestamp") ||
+		strings.HasPrefix(strings.ToUpper(strings.TrimSpace(p.Default)), "CURRENT_")
+}
+
+// formKeys returns the form field names the parameter is submitted under.
+func (p QueryParam) formKeys() []string {
+	if p.InputType() == "daterange" {
+		return []string{p.Name, p.Name + "_from", p.Name + "_to"}
+	}
+	return []string{p.Name}
+}
+
+func firstValue(vals []string) string {
+	for _, v := range vals {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func startOfWeek(d time.Time) time.Time {
+	offset := (int(d.Weekday()) + 6) % 7 // Monday = 0
+	return d.AddDate(0, 0, -offset)
+}
+
+func startOfMonth(d time.Time) time.Time {
+	return time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, d.Location())
+}
+
+func startOfQuarter(d time.Time) time.Time {
+	month := time.Month((int(d.Month())-1)/3*3 + 1)
+	return time.Date(d.Year(), month, 1, 0, 0, 0, 0, d.Location())
+}
+
+func startOfYear(d time.Time) time.Time {
+	return time.Date(d.Year(), time.January, 1, 0, 0, 0, 0, d.Location())
+}
+
+// addMonths adds n months, clamping the day to the end of the target month
+// (Jan 31 + 1 month = Feb 28/29).
+func addMonths(d time.Time, n int) time.Time {
+	first := time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, d.Location()).AddDate(0, n, 0)
+	last := first.AddDate(0, 1, -1).Day()
+	day := d.Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, d.Location())
+}
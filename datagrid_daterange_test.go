@@ -0,0 +1,214 @@
+package datagrid
+
+import (
+	"testing"
+	"time"
+)
+
+// Wednesday afternoon, so day truncation and week starts are exercised.
+var testNow = time.Date(2024, time.May, 15, 13, 45, 0, 0, time.UTC)
+
+func TestResolveDateExpr(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"CURRENT_DATE", "2024-05-15"},
+		{"current_timestamp", "2024-05-15"},
+		{"now()", "2024-05-15"},
+		{"today", "2024-05-15"},
+		{"yesterday", "2024-05-14"},
+		{"tomorrow", "2024-05-16"},
+		{"CURRENT_DATE - 30", "2024-04-15"},
+		{"CURRENT_DATE-30", "2024-04-15"},
+		{"current_date + 2 weeks", "2024-05-29"},
+		{"CURRENT_DATE - INTERVAL '1 month'", "2024-04-15"},
+		{"CURRENT_DATE - interval '3 days'", "2024-05-12"},
+		{"CURRENT_DATE - '30'", "2024-04-15"},
+		{"start_of_week", "2024-05-13"},
+		{"end_of_week", "2024-05-19"},
+		{"start_of_month", "2024-05-01"},
+		{"end_of_month", "2024-05-31"},
+		{"end_of_month+1", "2024-06-01"},
+		{"start_of_month - 1 month", "2024-04-01"},
+		{"start_of_quarter", "2024-04-01"},
+		{"end_of_quarter", "2024-06-30"},
+		{"start_of_year", "2024-01-01"},
+		{"end_of_year", "2024-12-31"},
+		{"  2024-03-10  ", "2024-03-10"},
+		{"2024-01-31 + 1 month", "2024-02-29"},
+		{"2024-03-31 - 1 month", "2024-02-29"},
+		{"2024-02-29 + 1 year", "2025-02-28"},
+		{"2024-12-31 + 1 day", "2025-01-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			d, ok := resolveDateExpr(tt.expr, testNow)
+			if !ok {
+				t.Fatalf("not resolved")
+			}
+			if got := d.Format(dateLayout); got != tt.want {
+				t.Errorf("resolved = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveDateExprRejects(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"NULL",
+		"last_tuesday",
+		"2024-13-01",
+		"2024-5-1",
+		"CURRENT_DATE * 2",
+		"CURRENT_DATE - 1 hour",
+		"CURRENT_DATE - -1",
+		"CURRENT_DATE - 30; DROP TABLE t",
+		"CURRENT_DATE - INTERVAL '1 day' OR 1=1",
+		"CURRENT_DATE::date",
+		"pg_sleep(10)",
+		"$$2024-01-01$$",
+	} {
+		if d, ok := resolveDateExpr(expr, testNow); ok {
+			t.Errorf("%q resolved to %s, want rejected", expr, d.Format(dateLayout))
+		}
+	}
+}
+
+func TestResolveDatePreset(t *testing.T) {
+	tests := []struct {
+		key      string
+		from, to string
+	}{
+		{"today", "2024-05-15", "2024-05-15"},
+		{"yesterday", "2024-05-14", "2024-05-14"},
+		{"last_7_days", "2024-05-09", "2024-05-15"},
+		{"this_week", "2024-05-13", "2024-05-19"},
+		{"this_month", "2024-05-01", "2024-05-31"},
+		{"last_month", "2024-04-01", "2024-04-30"},
+		{"this_quarter", "2024-04-01", "2024-06-30"},
+		{" YTD ", "2024-01-01", "2024-05-15"},
+		{"previous_year", "2023-01-01", "2023-12-31"},
+	}
+	for _, tt := range tests {
+		from, to, ok := resolveDatePreset(tt.key, testNow)
+		if !ok {
+			t.Errorf("%q: not a preset", tt.key)
+			continue
+		}
+		if f, l := from.Format(dateLayout), to.Format(dateLayout); f != tt.from || l != tt.to {
+			t.Errorf("%q = %s..%s, want %s..%s", tt.key, f, l, tt.from, tt.to)
+		}
+	}
+	if _, _, ok := resolveDatePreset("next_year", testNow); ok {
+		t.Error("next_year resolved as a preset")
+	}
+}
+
+func TestResolveDateRangeDefault(t *testing.T) {
+	tests := []struct {
+		def      string
+		from, to string
+	}{
+		{"", "", ""},
+		{"NULL", "", ""},
+		{"ytd", "2024-01-01", "2024-05-15"},
+		{"CURRENT_DATE - 30", "2024-04-15", "2024-05-15"},
+		{"start_of_month - 1 month .. CURRENT_DATE", "2024-04-01", "2024-05-15"},
+		{"2024-01-01..2024-01-31", "2024-01-01", "2024-01-31"},
+		{"bogus .. CURRENT_DATE", "", "2024-05-15"},
+	}
+	for _, tt := range tests {
+		from, to := resolveDateRangeDefault(tt.def, testNow)
+		if from != tt.from || to != tt.to {
+			t.Errorf("%q = %q..%q, want %q..%q", tt.def, from, to, tt.from, tt.to)
+		}
+	}
+}
+
+func TestBindRange(t *testing.T) {
+	tests := []struct {
+		typ, part, from, to string
+		want                interface{}
+	}{
+		{"DATE", "from", "2024-05-01", "2024-05-15", "2024-05-01"},
+		{"DATE", "to", "2024-05-01", "2024-05-15", "2024-05-15"},
+		{"DATE", "range", "2024-05-01", "2024-05-15", "[2024-05-01,2024-05-16)"},
+		{"TIMESTAMPTZ", "from", "2024-05-01", "2024-05-15", "2024-05-01"},
+		{"DATE", "before", "2024-05-01", "2024-05-15", "2024-05-16"},
+		{"TIMESTAMPTZ", "to", "2024-05-01", "2024-05-15", "2024-05-15"},
+		{"TIMESTAMPTZ", "before", "2024-05-01", "2024-05-15", "2024-05-16"},
+		{"timestamp", "before", "2024-05-01", "2024-12-31", "2025-01-01"},
+		{"TSTZRANGE", "range", "2024-05-01", "2024-05-15", "[2024-05-01,2024-05-16)"},
+		{"DATE", "from", "", "2024-05-15", nil},
+		{"TIMESTAMPTZ", "to", "2024-05-01", "", nil},
+		{"TIMESTAMPTZ", "before", "2024-05-01", "", nil},
+		{"DATE", "range", "", "2024-05-15", "[,2024-05-16)"},
+		{"DATE", "range", "2024-05-01", "", "[2024-05-01,)"},
+		{"DATE", "range", "", "", nil},
+	}
+	for _, tt := range tests {
+		p := QueryParam{Name: "created", Type: tt.typ}
+		got, err := p.bindRange(tt.part, tt.from, tt.to)
+		if err != nil {
+			t.Errorf("%s %s: %v", tt.typ, tt.part, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s %s %q..%q = %v, want %v", tt.typ, tt.part, tt.from, tt.to, got, tt.want)
+		}
+	}
+
+	p := QueryParam{Name: "created", Type: "TIMESTAMPTZ"}
+	if _, err := p.bindRange("before", "", "2024-02-30"); err == nil {
+		t.Error("invalid end date bound without error")
+	}
+}
+
+func TestRangeTypes(t *testing.T) {
+	tests := []struct {
+		typ          string
+		bound, whole string
+	}{
+		{"", "date", "daterange"},
+		{"DATE", "date", "daterange"},
+		{"daterange", "date", "daterange"},
+		{"TIMESTAMPTZ", "timestamptz", "tstzrange"},
+		{"tstzrange", "timestamptz", "tstzrange"},
+		{"timestamp with time zone", "timestamptz", "tstzrange"},
+		{"TIMESTAMP", "timestamp", "tsrange"},
+		{"tsrange", "timestamp", "tsrange"},
+	}
+	for _, tt := range tests {
+		p := QueryParam{Type: tt.typ}
+		if got := p.rangeBoundType(); got != tt.bound {
+			t.Errorf("%q bound = %s, want %s", tt.typ, got, tt.bound)
+		}
+		if got := p.rangeType(); got != tt.whole {
+			t.Errorf("%q range = %s, want %s", tt.typ, got, tt.whole)
+		}
+	}
+}
+
+func TestFindRangeParam(t *testing.T) {
+	params := []QueryParam{{Name: "created", Input: "daterange"}, {Name: "created_by", Input: "text"}}
+	tests := []struct {
+		name, param, part string
+	}{
+		{"created", "created", "range"},
+		{"created_from", "created", "from"},
+		{"created_to", "created", "to"},
+		{"created_before", "created", "before"},
+		{"created_by", "created_by", ""},
+	}
+	for _, tt := range tests {
+		p, part, ok := findParam(params, tt.name)
+		if !ok || p.Name != tt.param || part != tt.part {
+			t.Errorf("%s = %s %q %v, want %s %q", tt.name, p.Name, part, ok, tt.param, tt.part)
+		}
+	}
+	if _, _, ok := findParam(params, "created_until"); ok {
+		t.Error("created_until resolved to a parameter")
+	}
+}
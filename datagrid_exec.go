@@ -0,0 +1,93 @@
+package datagrid
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TimeoutError is returned when a query runs past the catalog's statement timeout or
+// the request's deadline. Templates render it with "datagrid_timeout".
+type TimeoutError struct {
+	Timeout time.Duration // Catalog timeout; zero when the request deadline expired
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Timeout > 0 {
+		return fmt.Sprintf("query exceeded the %s timeout: %v", e.Timeout, e.Err)
+	}
+	return fmt.Sprintf("query timed out: %v", e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error { return e.Err }
+
+// statementTimeout parses the catalog timeout: a Go duration ("30s", "2m") or a plain
+// number of seconds. Invalid values disable the timeout.
+func (h *Handler) statementTimeout() time.Duration {
+	t := strings.TrimSpace(h.Catalog.Timeout)
+	if t == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(t, 64); err == nil {
+		return time.Duration(secs * float64(time.Second))
+	}
+	d, err := time.ParseDuration(t)
+	if err != nil {
+		slog.Warn("invalid catalog timeout", "timeout", t, "error", err)
+		return 0
+	}
+	return d
+}
+
+// beginQueryTx opens the transaction every grid, pivot, export, query-mode and write
+// statement runs in, applying the catalog's statement timeout with SET LOCAL and the
+// session settings (see SessionSetting) RLS policies depend on.
+func (h *Handler) beginQueryTx(ctx context.Context) (*sql.Tx, error) {
+	return h.beginTx(ctx, h.sessionSettings())
+}
+
+// beginTx is beginQueryTx with the given session settings.
+func (h *Handler) beginTx(ctx context.Context, settings []SessionSetting) (*sql.Tx, error) {
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, h.queryError(ctx, err)
+	}
+	if d := h.statementTimeout(); d > 0 {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL statement_timeout = %d", d.Milliseconds())); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	if err := h.applySessionSettings(ctx, tx, settings); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// queryError maps statement-timeout cancellations (SQLSTATE 57014) and expired request
+// deadlines to *TimeoutError; other errors are returned unchanged.
+func (h *Handler) queryError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &TimeoutError{Err: err}
+	}
+	if ctx.Err() != nil {
+		return err // canceled by the client, nothing to render
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "57014" {
+		return &TimeoutError{Timeout: h.statementTimeout(), Err: err}
+	}
+	return err
+}
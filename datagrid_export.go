@@ -1,21 +1,48 @@
 package datagrid
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"io"
 )
 
+// StreamCSV runs StreamCSVContext without a request context.
 func (h *Handler) StreamCSV(w io.Writer, p RequestParams) error {
+	return h.StreamCSVContext(context.Background(), w, p)
+}
+
+// StreamCSVContext writes every row of the filtered grid (same filters and search as
+// FetchData, all pages) as CSV lines, cancelled with ctx and limited by the catalog timeout.
+// Query-mode catalogs export the rows of their SQL for p.Values (see streamQueryCSV).
+func (h *Handler) StreamCSVContext(ctx context.Context, w io.Writer, p RequestParams) error {
+	p.Limit, p.Offset = 0, 0
+	p.export = true
+	if h.IsQueryMode {
+		return h.streamQueryCSV(ctx, w, p)
+	}
+	if err := h.resolveAccess(ctx, &p); err != nil {
+		return err
+	}
+
 	// 1. Generate Hybrid SQL
 	query, configJSON, err := h.BuildGridSQL(p)
 	if err != nil {
 		return err
 	}
 
-	rows, err := h.DB.Query("SELECT datagrid.datagrid_execute_csv($1, $2)", query, configJSON)
+	tx, err := h.beginQueryTx(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	h.applySearchSettings(ctx, tx)
+
+	rows, err := tx.QueryContext(ctx, "SELECT datagrid.datagrid_execute_csv($1, $2)", query, configJSON)
+	if err != nil {
+		return h.queryError(ctx, err)
+	}
 	defer rows.Close()
 
 	for rows.Next() {
@@ -24,5 +51,53 @@ func (h *Handler) StreamCSV(w io.Writer, p RequestParams) error {
 			fmt.Fprintln(w, line)
 		}
 	}
-	return nil
+	if err := rows.Err(); err != nil {
+		return h.queryError(ctx, err)
+	}
+	return tx.Commit()
+}
+
+// streamQueryCSV exports a query-mode catalog: the statement ExecuteQueryParams pages
+// through, unpaged, written in the header and line format of datagrid_execute_csv.
+func (h *Handler) streamQueryCSV(ctx context.Context, w io.Writer, p RequestParams) error {
+	source, where, args, err := h.queryStatement(ctx, &p)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s %s %s", h.queryProjection(p.access), source, where, h.buildOrder(p.Sort))
+
+	tx, err := h.beginQueryTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	h.applySearchSettings(ctx, tx)
+
+	var header sql.NullString
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT string_agg(quote_ident(key), ',' ORDER BY key)
+		FROM jsonb_object_keys((SELECT to_jsonb(t) FROM (%s LIMIT 1) t)) key`, query), args...).Scan(&header)
+	if err != nil {
+		return h.queryError(ctx, err)
+	}
+	if header.Valid {
+		fmt.Fprintln(w, header.String)
+	}
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT datagrid.jsonb_object_to_csv_line(to_jsonb(t)) FROM (%s) AS t", query), args...)
+	if err != nil {
+		return h.queryError(ctx, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err == nil {
+			fmt.Fprintln(w, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return h.queryError(ctx, err)
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,137 @@
+package datagrid
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// FacetCount is the number of rows a filter value matches under the request's other
+// filters and search. Empty values (no match) are greyed out by the filter bar.
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+	Empty bool   `json:"empty,omitempty"`
+}
+
+// facetFilters returns the names of the catalog filters counted per value: those whose
+// column has an LOV, i.e. the ones the filter bar renders as toggles or dropdowns.
+func (h *Handler) facetFilters() []string {
+	var names []string
+	for name, fd := range h.Config.Filters {
+		field := fd.Column
+		if field == "" {
+			field = name
+		}
+		if col, ok := h.uiColumn(field); ok && len(col.LOV) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// filterName returns the catalog filter a request filter key ("status",
+// "salary__gte") belongs to.
+func (h *Handler) filterName(key string) string {
+	if _, ok := h.Config.Filters[key]; ok {
+		return key
+	}
+	if i := strings.LastIndex(key, "__"); i > 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// facets counts the rows per value of every LOV filter (datagrid.facets), one GROUP BY
+// per filter. Each count applies all active filters except the filter's own, plus the
+// searches, so it tells how many rows selecting that value would show. LOV values with
+// no rows are reported with Empty set.
+func (h *Handler) facets(ctx context.Context, tx *sql.Tx, p RequestParams) (map[string][]FacetCount, error) {
+	if !h.Config.Facets {
+		return nil, nil
+	}
+	names := h.facetFilters()
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	result := make(map[string][]FacetCount, len(names))
+	for _, name := range names {
+		field := h.Config.Filters[name].Column
+		if field == "" {
+			field = name
+		}
+		if h.restrictedField(p.access, field) {
+			continue
+		}
+
+		others := p
+		others.Filters = make(map[string][]string, len(p.Filters))
+		for key, vals := range p.Filters {
+			if h.filterName(key) != name {
+				others.Filters[key] = vals
+			}
+		}
+		pred, err := h.compileWhere(others, positionalArgs(1), h.fromClause())
+		if err != nil {
+			return nil, err
+		}
+
+		query := fmt.Sprintf("SELECT (%s)::text, COUNT(*) FROM %s %s GROUP BY 1",
+			h.columnExpr(field), h.fromClause(), pred.Where())
+
+		counts := map[string]int{}
+		if err := facetRows(ctx, tx, query, counts, pred.Args...); err != nil {
+			if os.Getenv("DEBUG_SQL") == "true" {
+				fmt.Printf("--- FACET QUERY ERROR ---\nQuery: %s\nError: %v\n------------------------\n", query, err)
+			}
+			return nil, fmt.Errorf("failed to count facet %s: %w", name, h.queryError(ctx, err))
+		}
+
+		// LOV order first, then values the LOV does not list
+		col, _ := h.uiColumn(field)
+		var facets []FacetCount
+		for _, item := range col.LOV {
+			v := fmt.Sprintf("%v", item.Value)
+			n, ok := counts[v]
+			facets = append(facets, FacetCount{Value: v, Count: n, Empty: n == 0})
+			if ok {
+				delete(counts, v)
+			}
+		}
+		rest := make([]string, 0, len(counts))
+		for v := range counts {
+			rest = append(rest, v)
+		}
+		sort.Strings(rest)
+		for _, v := range rest {
+			facets = append(facets, FacetCount{Value: v, Count: counts[v]})
+		}
+		result[field] = facets
+	}
+	return result, nil
+}
+
+// facetRows reads value/count pairs into counts; NULL values are not counted.
+func facetRows(ctx context.Context, tx *sql.Tx, query string, counts map[string]int, args ...interface{}) error {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v sql.NullString
+		var n int
+		if err := rows.Scan(&v, &n); err != nil {
+			return err
+		}
+		if v.Valid {
+			counts[v.String] = n
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,124 @@
+package datagrid
+
+import (
+	"fmt"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// Markers ts_headline puts around matches; highlight turns them into <mark> after
+// escaping the snippet, so the highlighted text itself is never trusted as HTML.
+const (
+	headlineStart = "\ue000"
+	headlineStop  = "\ue001"
+)
+
+// ftsMatch carries the parts of a full-text search the grid statement uses besides the
+// WHERE condition.
+type ftsMatch struct {
+	rank      string        // ts_rank of the matched document
+	headlines []ftsHeadline // Snippets returned as <field>_headline
+}
+
+type ftsHeadline struct {
+	Field string
+	SQL   string
+}
+
+var regconfigPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
+// ftsEnabled reports whether the global search uses full-text search.
+func (h *Handler) ftsEnabled() bool {
+	return strings.EqualFold(strings.TrimSpace(h.Config.Searchable.Operator), "fts")
+}
+
+// ftsConfig is the text search configuration as a regconfig literal; "simple" unless the
+// catalog names a valid one.
+func (h *Handler) ftsConfig() string {
+	cfg := strings.ToLower(strings.TrimSpace(h.Config.Searchable.Config))
+	if !regconfigPattern.MatchString(cfg) {
+		cfg = "simple"
+	}
+	return fmt.Sprintf("'%s'::regconfig", cfg)
+}
+
+// compileFTS adds the full-text condition: the searchable columns form one weighted
+// tsvector (searchable.weights, D by default) matched against websearch_to_tsquery, so
+// quoted phrases, "or" and -exclusions work as in web search engines.
+func (h *Handler) compileFTS(b *whereBuilder, search string) {
+	type searchColumn struct {
+		field string // "" for raw SQL entries of searchable.columns
+		sql   string
+	}
+	var cols []searchColumn
+	if len(h.Config.Searchable.Columns) > 0 {
+		for _, sc := range h.Config.Searchable.Columns {
+			if h.restrictedField(b.access, sc) {
+				continue
+			}
+			if _, known := h.columnExprs[sc]; known {
+				cols = append(cols, searchColumn{field: sc, sql: h.columnExpr(sc)})
+			} else {
+				cols = append(cols, searchColumn{sql: sc})
+			}
+		}
+	} else {
+		for _, c := range h.Columns {
+			if h.restrictedField(b.access, c.Field) {
+				continue
+			}
+			if c.Type == "" || c.Type == "text" || c.Type == "varchar" || c.Type == "string" {
+				cols = append(cols, searchColumn{field: c.Field, sql: h.columnExpr(c.Field)})
+			}
+		}
+	}
+	if len(cols) == 0 {
+		return
+	}
+
+	cfg := h.ftsConfig()
+	query := fmt.Sprintf("websearch_to_tsquery(%s, %s)", cfg, b.bind(search, "text"))
+
+	headlineOf := make(map[string]bool, len(h.Config.Searchable.Headlines))
+	for _, f := range h.Config.Searchable.Headlines {
+		headlineOf[f] = true
+	}
+
+	m := &ftsMatch{}
+	vectors := make([]string, len(cols))
+	for i, c := range cols {
+		key := c.field
+		if key == "" {
+			key = c.sql
+		}
+		weight := strings.ToUpper(strings.TrimSpace(h.Config.Searchable.Weights[key]))
+		if weight != "A" && weight != "B" && weight != "C" {
+			weight = "D"
+		}
+		vector := fmt.Sprintf("to_tsvector(%s, coalesce((%s)::text, ''))", cfg, c.sql)
+		vectors[i] = fmt.Sprintf("setweight(%s, '%s')", vector, weight)
+
+		if c.field != "" && (len(headlineOf) == 0 || headlineOf[c.field]) {
+			m.headlines = append(m.headlines, ftsHeadline{
+				Field: c.field,
+				SQL: fmt.Sprintf("CASE WHEN %s @@ %s THEN ts_headline(%s, (%s)::text, %s, 'StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=20, MinWords=5') END",
+					vector, query, cfg, c.sql, query, headlineStart, headlineStop),
+			})
+		}
+	}
+	document := "(" + strings.Join(vectors, " || ") + ")"
+	m.rank = fmt.Sprintf("ts_rank(%s, %s)", document, query)
+
+	b.add(fmt.Sprintf("%s @@ %s", document, query))
+	b.fts = m
+}
+
+// highlight renders a ts_headline snippet: the text is escaped and the match markers
+// become <mark> elements.
+func highlight(v interface{}) template.HTML {
+	s := template.HTMLEscapeString(fmt.Sprintf("%v", v))
+	s = strings.ReplaceAll(s, headlineStart, "<mark>")
+	s = strings.ReplaceAll(s, headlineStop, "</mark>")
+	return template.HTML(s)
+}
@@ -0,0 +1,167 @@
+package datagrid
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// resolveSources builds the FROM clause and the SQL expression of every catalog column:
+// objects after the first one that declare a join are joined to the main object (or an
+// earlier joined object), and columns with "from": "<object>.<column>" read from them.
+func (h *Handler) resolveSources() error {
+	objs := h.Catalog.Objects
+	if len(objs) == 0 {
+		return nil
+	}
+	main := objs[0]
+
+	aliases := map[string]string{main.Name: "src"}
+	declared := map[string]map[string]bool{main.Name: columnSet(main)}
+	var joins strings.Builder
+	for i, obj := range objs[1:] {
+		if obj.Join == nil {
+			continue
+		}
+		if _, dup := aliases[obj.Name]; dup {
+			return fmt.Errorf("object %s is declared more than once, so references to it are ambiguous", obj.Name)
+		}
+		alias := fmt.Sprintf("j%d", i+1)
+		parent := obj.Join.Object
+		if parent == "" {
+			parent = main.Name
+		}
+		parentAlias, ok := aliases[parent]
+		if !ok {
+			return fmt.Errorf("object %s: join refers to unknown object %q", obj.Name, parent)
+		}
+		if len(obj.Join.On) == 0 {
+			return fmt.Errorf("object %s: join has no on columns", obj.Name)
+		}
+
+		kind := "LEFT JOIN"
+		switch strings.ToLower(strings.TrimSpace(obj.Join.Type)) {
+		case "", "left":
+		case "inner":
+			kind = "JOIN"
+		default:
+			return fmt.Errorf("object %s: unsupported join type %q", obj.Name, obj.Join.Type)
+		}
+
+		// Column pairs in key order, so the SQL text is stable
+		locals := make([]string, 0, len(obj.Join.On))
+		for local := range obj.Join.On {
+			locals = append(locals, local)
+		}
+		sort.Strings(locals)
+		conds := make([]string, 0, len(locals))
+		for _, local := range locals {
+			foreign := obj.Join.On[local]
+			if !hasColumn(declared[parent], local) {
+				return fmt.Errorf("object %s: join column %q is not a column of %s", obj.Name, local, parent)
+			}
+			if !hasColumn(columnSet(obj), foreign) {
+				return fmt.Errorf("object %s: join column %q is not a column of %s", obj.Name, foreign, obj.Name)
+			}
+			conds = append(conds, fmt.Sprintf("%s.%s = %s.%s", alias, quote_ident(foreign), parentAlias, quote_ident(local)))
+		}
+		fmt.Fprintf(&joins, "\n%s %s AS %s ON %s", kind, quote_ident(obj.Name), alias, strings.Join(conds, " AND "))
+
+		aliases[obj.Name] = alias
+		declared[obj.Name] = columnSet(obj)
+	}
+	h.joins = joins.String()
+
+	h.columnExprs = make(map[string]string, len(main.Columns))
+	for _, col := range main.Columns {
+		if col.Expr != "" || col.Path != "" {
+			continue // resolved below, once every stored and lookup column is known
+		}
+		if col.From == "" {
+			h.columnExprs[col.Name] = filterColumn(col.Name)
+			continue
+		}
+		dot := strings.LastIndex(col.From, ".")
+		if dot <= 0 {
+			return fmt.Errorf("column %s: from must be <object>.<column>, got %q", col.Name, col.From)
+		}
+		object, field := col.From[:dot], col.From[dot+1:]
+		alias, ok := aliases[object]
+		if !ok || alias == "src" {
+			return fmt.Errorf("column %s: %q is not a joined object", col.Name, object)
+		}
+		if !hasColumn(declared[object], field) {
+			return fmt.Errorf("column %s: %q is not a column of %s", col.Name, field, object)
+		}
+		h.columnExprs[col.Name] = alias + "." + quote_ident(field)
+	}
+
+	// JSON columns extract from a stored or lookup jsonb column; computed ones may use them
+	jsonCols := make(map[string]string)
+	for _, col := range main.Columns {
+		if col.Path == "" || col.Expr != "" {
+			continue
+		}
+		expr, err := h.jsonPathExpr(col.Path, col.Type)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col.Name, err)
+		}
+		jsonCols[col.Name] = expr
+	}
+	for name, expr := range jsonCols {
+		h.columnExprs[name] = expr
+	}
+
+	computed := make(map[string]string)
+	for _, col := range main.Columns {
+		if col.Expr == "" {
+			continue
+		}
+		expr, err := h.compileExpr(col.Expr)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", col.Name, err)
+		}
+		if col.Type == "" {
+			return fmt.Errorf("column %s: computed columns need a type", col.Name)
+		}
+		computed[col.Name] = fmt.Sprintf("((%s)::%s)", expr, columnCast(col.Type))
+	}
+	for name, expr := range computed {
+		h.columnExprs[name] = expr
+	}
+	return nil
+}
+
+// columnSet lists the declared columns of an object; nil when none are declared, in
+// which case any column name is accepted.
+func columnSet(obj ObjectDef) map[string]bool {
+	if len(obj.Columns) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(obj.Columns))
+	for _, c := range obj.Columns {
+		if c.From == "" && c.Expr == "" && c.Path == "" {
+			set[c.Name] = true
+		}
+	}
+	return set
+}
+
+func hasColumn(set map[string]bool, name string) bool {
+	return name != "" && (set == nil || set[name])
+}
+
+// fromClause is the FROM item every grid, count, pivot and export statement reads: the
+// main object aliased src, followed by the declared joins.
+func (h *Handler) fromClause() string {
+	return quote_ident(h.TableName) + " AS src" + h.joins
+}
+
+// columnExpr returns the SQL expression of a catalog column (src."col", or the joined
+// object's column for lookup columns). Other names are qualified with src as is.
+func (h *Handler) columnExpr(field string) string {
+	if e, ok := h.columnExprs[field]; ok {
+		return e
+	}
+	return filterColumn(field)
+}
@@ -0,0 +1,154 @@
+package datagrid
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestResolveSourcesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		objects string
+		err     string
+	}{
+		{
+			"unknown join object",
+			`[{"name": "orders", "columns": [{"name": "id"}]},
+			  {"name": "customers", "join": {"object": "clients", "on": {"customer_id": "id"}}, "columns": [{"name": "id"}]}]`,
+			`object customers: join refers to unknown object "clients"`,
+		},
+		{
+			"unknown lookup object",
+			`[{"name": "orders", "columns": [{"name": "id"}, {"name": "customer_id"}, {"name": "customer", "from": "clients.name"}]},
+			  {"name": "customers", "join": {"on": {"customer_id": "id"}}, "columns": [{"name": "id"}, {"name": "name"}]}]`,
+			`column customer: "clients" is not a joined object`,
+		},
+		{
+			"lookup on the main object",
+			`[{"name": "orders", "columns": [{"name": "id"}, {"name": "ref", "from": "orders.id"}]}]`,
+			`column ref: "orders" is not a joined object`,
+		},
+		{
+			"unknown lookup column",
+			`[{"name": "orders", "columns": [{"name": "id"}, {"name": "customer_id"}, {"name": "customer", "from": "customers.title"}]},
+			  {"name": "customers", "join": {"on": {"customer_id": "id"}}, "columns": [{"name": "id"}, {"name": "name"}]}]`,
+			`column customer: "title" is not a column of customers`,
+		},
+		{
+			"malformed from",
+			`[{"name": "orders", "columns": [{"name": "id"}, {"name": "customer", "from": "name"}]}]`,
+			`column customer: from must be <object>.<column>, got "name"`,
+		},
+		{
+			"ambiguous object",
+			`[{"name": "orders", "columns": [{"name": "id"}, {"name": "customer_id"}, {"name": "agent_id"}]},
+			  {"name": "people", "join": {"on": {"customer_id": "id"}}, "columns": [{"name": "id"}]},
+			  {"name": "people", "join": {"on": {"agent_id": "id"}}, "columns": [{"name": "id"}]}]`,
+			`object people is declared more than once, so references to it are ambiguous`,
+		},
+		{
+			"self join",
+			`[{"name": "staff", "columns": [{"name": "id"}, {"name": "manager_id"}]},
+			  {"name": "staff", "join": {"on": {"manager_id": "id"}}, "columns": [{"name": "id"}]}]`,
+			`object staff is declared more than once, so references to it are ambiguous`,
+		},
+		{
+			"unknown join column",
+			`[{"name": "orders", "columns": [{"name": "id"}]},
+			  {"name": "customers", "join": {"on": {"customer_id": "id"}}, "columns": [{"name": "id"}]}]`,
+			`object customers: join column "customer_id" is not a column of orders`,
+		},
+		{
+			"no join columns",
+			`[{"name": "orders", "columns": [{"name": "id"}]},
+			  {"name": "customers", "join": {"on": {}}, "columns": [{"name": "id"}]}]`,
+			`object customers: join has no on columns`,
+		},
+		{
+			"unsupported join type",
+			`[{"name": "orders", "columns": [{"name": "id"}, {"name": "customer_id"}]},
+			  {"name": "customers", "join": {"on": {"customer_id": "id"}, "type": "outer"}, "columns": [{"name": "id"}]}]`,
+			`object customers: unsupported join type "outer"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{}
+			if err := json.Unmarshal([]byte(tt.objects), &h.Catalog.Objects); err != nil {
+				t.Fatal(err)
+			}
+			if err := h.resolveSources(); err == nil || err.Error() != tt.err {
+				t.Errorf("err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestResolveSourcesJoins(t *testing.T) {
+	h := &Handler{}
+	objects := `[
+		{"name": "orders", "columns": [{"name": "id"}, {"name": "customer_id"}, {"name": "customer", "from": "customers.name"}, {"name": "region", "from": "regions.name"}]},
+		{"name": "customers", "join": {"on": {"customer_id": "id"}}, "columns": [{"name": "id"}, {"name": "name"}, {"name": "region_id"}]},
+		{"name": "regions", "join": {"object": "customers", "on": {"region_id": "id"}, "type": "inner"}, "columns": [{"name": "id"}, {"name": "name"}]}
+	]`
+	if err := json.Unmarshal([]byte(objects), &h.Catalog.Objects); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.resolveSources(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "\nLEFT JOIN \"customers\" AS j1 ON j1.\"id\" = src.\"customer_id\"\nJOIN \"regions\" AS j2 ON j2.\"id\" = j1.\"region_id\""; h.joins != want {
+		t.Errorf("joins = %q, want %q", h.joins, want)
+	}
+	if got := h.columnExpr("customer"); got != `j1."name"` {
+		t.Errorf("customer = %s", got)
+	}
+	if got := h.columnExpr("region"); got != `j2."name"` {
+		t.Errorf("region = %s", got)
+	}
+}
+
+func TestSQLTemplateOverride(t *testing.T) {
+	defaults, err := parseSQLTemplates(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A file missing from the override keeps the embedded default
+	set, err := parseSQLTemplates(fstest.MapFS{
+		"grid.sql.tmpl": {Data: []byte("SELECT 1 FROM {{.From}}")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set["grid.sql"].Root.String() == defaults["grid.sql"].Root.String() {
+		t.Error("grid.sql override ignored")
+	}
+	if set["pivot.sql"].Root.String() != defaults["pivot.sql"].Root.String() {
+		t.Error("pivot.sql missing from the override does not fall back to the default")
+	}
+	if err := checkSQLTemplates(defaults); err != nil {
+		t.Errorf("defaults fail the check: %v", err)
+	}
+
+	if _, err := parseSQLTemplates(fstest.MapFS{
+		"pivot.sql.tmpl": {Data: []byte("SELECT {{.Broken")},
+	}); err == nil || !strings.HasPrefix(err.Error(), "SQL template pivot.sql.tmpl: ") {
+		t.Errorf("broken override: err = %v", err)
+	}
+
+	// A directory in place of the file is not a missing file: no silent fallback
+	if _, err := parseSQLTemplates(fstest.MapFS{
+		"grid.sql.tmpl/x": {Data: []byte("x")},
+	}); err == nil || errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("unreadable override: err = %v", err)
+	}
+
+	if _, err := defaults.render("count.sql", nil); err == nil || err.Error() != `unknown SQL template "count.sql"` {
+		t.Errorf("unknown template: err = %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package datagrid
+
+import (
+	"fmt"
+	"strings"
+)
+
+// jsonExtractors maps a JSON column type to the suffix of its json_operators.sql extractor
+// (public.jsonb_extract_<t> for one key, public.jsonb_path_extract_<t> for nested keys).
+var jsonExtractors = map[string]string{
+	"numeric": "numeric", "decimal": "numeric", "number": "numeric", "double": "numeric",
+	"real": "numeric", "float": "numeric",
+	"integer": "integer", "int": "integer", "int4": "integer", "smallint": "integer",
+	"bigint": "bigint", "int8": "bigint",
+	"boolean": "boolean", "bool": "boolean",
+	"timestamp": "timestamp", "date": "timestamp",
+	"timestamptz": "timestamptz", "timestamp with time zone": "timestamptz",
+}
+
+// jsonPathExpr renders the typed extraction of a JSON column: path is the jsonb column
+// followed by the keys ("data.address.city"). Text columns use ->> / #>>, other types
+// the extractor functions of database/json_operators.sql, so filters, ranges, sorting and
+// aggregates compare typed values.
+func (h *Handler) jsonPathExpr(path, colType string) (string, error) {
+	parts := strings.Split(path, ".")
+	if len(parts) < 2 {
+		return "", fmt.Errorf("path must be <column>.<key>, got %q", path)
+	}
+	src, ok := h.columnExprs[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("path %q: unknown column %q", path, parts[0])
+	}
+	keys := make([]string, len(parts)-1)
+	for i, k := range parts[1:] {
+		if k == "" {
+			return "", fmt.Errorf("path %q has an empty key", path)
+		}
+		keys[i] = "'" + strings.ReplaceAll(k, "'", "''") + "'"
+	}
+	arg := keys[0]
+	if len(keys) > 1 {
+		arg = "ARRAY[" + strings.Join(keys, ",") + "]"
+	}
+
+	t := strings.ToLower(strings.TrimSpace(colType))
+	switch t {
+	case "", "text", "varchar", "string":
+		if len(keys) > 1 {
+			return fmt.Sprintf("(%s #>> %s)", src, arg), nil
+		}
+		return fmt.Sprintf("(%s ->> %s)", src, arg), nil
+	}
+	ext, ok := jsonExtractors[t]
+	if !ok {
+		return "", fmt.Errorf("path %q: unsupported type %q", path, colType)
+	}
+	fn := "public.jsonb_extract_" + ext
+	if len(keys) > 1 {
+		fn = "public.jsonb_path_extract_" + ext
+	}
+	expr := fmt.Sprintf("%s(%s, %s)", fn, src, arg)
+	if t == "date" {
+		expr = "(" + expr + ")::date"
+	}
+	return expr, nil
+}
@@ -0,0 +1,45 @@
+package datagrid
+
+import "testing"
+
+func TestJSONPathExpr(t *testing.T) {
+	h := &Handler{columnExprs: map[string]string{"data": `src."data"`}}
+	tests := []struct {
+		path, typ string
+		want      string
+		err       string
+	}{
+		{"data.city", "", `(src."data" ->> 'city')`, ""},
+		{"data.address.city", "text", `(src."data" #>> ARRAY['address','city'])`, ""},
+		{"data.o'k", "varchar", `(src."data" ->> 'o''k')`, ""},
+		{"data.salary", "numeric", `public.jsonb_extract_numeric(src."data", 'salary')`, ""},
+		{"data.years", "INT", `public.jsonb_extract_integer(src."data", 'years')`, ""},
+		{"data.pay.total", "bigint", `public.jsonb_path_extract_bigint(src."data", ARRAY['pay','total'])`, ""},
+		{"data.active", "bool", `public.jsonb_extract_boolean(src."data", 'active')`, ""},
+		{"data.hired", "date", `(public.jsonb_extract_timestamp(src."data", 'hired'))::date`, ""},
+		{"data.seen", "timestamp", `public.jsonb_extract_timestamp(src."data", 'seen')`, ""},
+		{"data.seen", "timestamptz", `public.jsonb_extract_timestamptz(src."data", 'seen')`, ""},
+		{"data.log.at", "timestamp with time zone", `public.jsonb_path_extract_timestamptz(src."data", ARRAY['log','at'])`, ""},
+		{"data", "text", "", `path must be <column>.<key>, got "data"`},
+		{"other.city", "text", "", `path "other.city": unknown column "other"`},
+		{"data..city", "text", "", `path "data..city" has an empty key`},
+		{"data.area", "point", "", `path "data.area": unsupported type "point"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.typ, func(t *testing.T) {
+			got, err := h.jsonPathExpr(tt.path, tt.typ)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expr = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
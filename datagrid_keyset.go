@@ -0,0 +1,257 @@
+package datagrid
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+)
+
+// keyColumn is one column of the keyset: a sort column or a primary-key tiebreaker.
+type keyColumn struct {
+	SQL        string // Expression in WHERE, qualified with src
+	Expr       string // Expression in ORDER BY
+	Cast       string // Type the cursor value is bound as
+	Desc       bool
+	NullsFirst bool
+}
+
+// keysetPage is the seek state of a keyset-paginated request.
+type keysetPage struct {
+	cols     []keyColumn
+	sig      string    // Identifies the ordering the cursor was issued for
+	backward bool      // Fetching the page before the cursor
+	after    []*string // Key of the cursor row as text, nil for NULL; nil on the first page
+}
+
+// keysetCursor is the JSON inside an opaque cursor token.
+type keysetCursor struct {
+	Dir string    `json:"d"` // "n" (next) or "p" (prev)
+	Sig string    `json:"s"`
+	Key []*string `json:"k"`
+}
+
+// keysetAlias is the hidden output column carrying the i-th key value of every row.
+func keysetAlias(i int) string {
+	return fmt.Sprintf("_k%d", i)
+}
+
+// keysetEnabled reports whether the grid pages by key instead of LIMIT/OFFSET.
+func (h *Handler) keysetEnabled() bool {
+	return strings.EqualFold(h.Config.Pagination, "keyset") && !h.IsQueryMode
+}
+
+// keyset resolves the keyset of a request: the active sort columns followed by the primary
+// key (ColumnDef.PrimaryKey, else an "id" column) so every row has a unique position. It
+// returns nil when the catalog has no usable key or the request is not paged; invalid or
+// stale cursors restart from the first page.
+func (h *Handler) keyset(p RequestParams) *keysetPage {
+	if !h.keysetEnabled() || p.Limit <= 0 {
+		return nil
+	}
+
+	colTypes := make(map[string]string)
+	var pks []string
+	if len(h.Catalog.Objects) > 0 {
+		for _, col := range h.Catalog.Objects[0].Columns {
+			colTypes[col.Name] = col.Type
+			if col.PrimaryKey {
+				pks = append(pks, col.Name)
+			}
+		}
+	}
+	if len(pks) == 0 {
+		if _, ok := colTypes["id"]; !ok {
+			return nil
+		}
+		pks = []string{"id"}
+	}
+
+	ks := &keysetPage{}
+	seen := make(map[string]bool)
+	for _, oc := range h.orderColumns(p.Sort) {
+		dir := strings.ToUpper(oc.Dir)
+		desc := strings.HasPrefix(dir, "DESC")
+		kc := keyColumn{SQL: oc.Expr, Expr: oc.Expr, Cast: "text", Desc: desc, NullsFirst: desc}
+		if strings.HasSuffix(dir, "NULLS FIRST") {
+			kc.NullsFirst = true
+		} else if strings.HasSuffix(dir, "NULLS LAST") {
+			kc.NullsFirst = false
+		}
+		if oc.Field != "" {
+			kc.SQL = h.columnExpr(oc.Field)
+			kc.Cast = columnCast(colTypes[oc.Field])
+			seen[oc.Field] = true
+		}
+		ks.cols = append(ks.cols, kc)
+	}
+	for _, pk := range pks {
+		if !seen[pk] {
+			ks.cols = append(ks.cols, keyColumn{SQL: h.columnExpr(pk), Expr: quote_ident(pk), Cast: columnCast(colTypes[pk])})
+		}
+	}
+
+	sig := fnv.New32a()
+	for _, kc := range ks.cols {
+		fmt.Fprintf(sig, "%s %t %t;", kc.Expr, kc.Desc, kc.NullsFirst)
+	}
+	ks.sig = fmt.Sprintf("%08x", sig.Sum32())
+
+	if c, ok := decodeCursor(p.Cursor); ok && c.Sig == ks.sig && len(c.Key) == len(ks.cols) {
+		ks.backward = c.Dir == "p"
+		ks.after = c.Key
+	}
+	return ks
+}
+
+var castPattern = regexp.MustCompile(`^[a-z][a-z0-9_ ]*(\(\d+(,\s*\d+)?\))?(\[\])?$`)
+
+// serialTypes maps the serial pseudo-types, which are not castable, to their storage type.
+var serialTypes = map[string]string{
+	"smallserial": "smallint",
+	"serial2":     "smallint",
+	"serial":      "integer",
+	"serial4":     "integer",
+	"bigserial":   "bigint",
+	"serial8":     "bigint",
+}
+
+// columnCast maps a catalog column type to a SQL cast (cursor values, computed columns,
+// row keys).
+func columnCast(colType string) string {
+	t := strings.ToLower(strings.TrimSpace(colType))
+	switch {
+	case t == "":
+		return "text"
+	case t == "int_bool":
+		return "integer"
+	case serialTypes[t] != "":
+		return serialTypes[t]
+	case castPattern.MatchString(t):
+		return t
+	}
+	return "text"
+}
+
+// order renders the keyset ORDER BY; backward pages read the reversed order.
+func (ks *keysetPage) order() string {
+	terms := make([]string, len(ks.cols))
+	for i, kc := range ks.cols {
+		desc, nullsFirst := kc.Desc, kc.NullsFirst
+		if ks.backward {
+			desc, nullsFirst = !desc, !nullsFirst
+		}
+		dir, nulls := "ASC", "NULLS LAST"
+		if desc {
+			dir = "DESC"
+		}
+		if nullsFirst {
+			nulls = "NULLS FIRST"
+		}
+		terms[i] = fmt.Sprintf("%s %s %s", kc.Expr, dir, nulls)
+	}
+	return "ORDER BY " + strings.Join(terms, ", ")
+}
+
+// seek adds the condition selecting the rows after (or, backward, before) the cursor key:
+// an OR over "equal on the first i columns and past the cursor on column i", with NULLs
+// placed as the ORDER BY places them.
+func (ks *keysetPage) seek(b *whereBuilder) {
+	if ks.after == nil {
+		return
+	}
+	var branches []string
+	for i, kc := range ks.cols {
+		var terms []string
+		for j := 0; j < i; j++ {
+			if v := ks.after[j]; v == nil {
+				terms = append(terms, ks.cols[j].SQL+" IS NULL")
+			} else {
+				terms = append(terms, fmt.Sprintf("%s = %s", ks.cols[j].SQL, b.bind(*v, ks.cols[j].Cast)))
+			}
+		}
+
+		desc, nullsFirst := kc.Desc, kc.NullsFirst
+		if ks.backward {
+			desc, nullsFirst = !desc, !nullsFirst
+		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		switch v := ks.after[i]; {
+		case v == nil && !nullsFirst:
+			continue // nothing sorts after NULL
+		case v == nil:
+			terms = append(terms, kc.SQL+" IS NOT NULL")
+		case nullsFirst:
+			terms = append(terms, fmt.Sprintf("%s %s %s", kc.SQL, op, b.bind(*v, kc.Cast)))
+		default:
+			terms = append(terms, fmt.Sprintf("(%s %s %s OR %s IS NULL)", kc.SQL, op, b.bind(*v, kc.Cast), kc.SQL))
+		}
+		branches = append(branches, "("+strings.Join(terms, " AND ")+")")
+	}
+	if len(branches) == 0 {
+		b.add("1=0")
+		return
+	}
+	b.add("(" + strings.Join(branches, " OR ") + ")")
+}
+
+// paginate trims the extra row fetched to detect another page, restores the display order
+// of backward pages, and returns the cursors of the neighbouring pages ("" when none).
+// The hidden key columns are removed from the records.
+func (ks *keysetPage) paginate(records []map[string]interface{}, limit int) (page []map[string]interface{}, prev, next string) {
+	more := len(records) > limit
+	if more {
+		records = records[:limit]
+	}
+	if ks.backward {
+		for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+			records[i], records[j] = records[j], records[i]
+		}
+	}
+
+	if len(records) > 0 {
+		hasPrev := ks.after != nil && !ks.backward || ks.backward && more
+		hasNext := !ks.backward && more || ks.backward
+		if hasPrev {
+			prev = ks.cursor("p", records[0])
+		}
+		if hasNext {
+			next = ks.cursor("n", records[len(records)-1])
+		}
+	}
+	for _, row := range records {
+		for i := range ks.cols {
+			delete(row, keysetAlias(i))
+		}
+	}
+	return records, prev, next
+}
+
+func (ks *keysetPage) cursor(dir string, row map[string]interface{}) string {
+	c := keysetCursor{Dir: dir, Sig: ks.sig, Key: make([]*string, len(ks.cols))}
+	for i := range ks.cols {
+		if v, ok := row[keysetAlias(i)]; ok && v != nil {
+			s := fmt.Sprintf("%v", v)
+			c.Key[i] = &s
+		}
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(token string) (keysetCursor, bool) {
+	var c keysetCursor
+	if token == "" {
+		return c, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || json.Unmarshal(data, &c) != nil || (c.Dir != "n" && c.Dir != "p") {
+		return c, false
+	}
+	return c, true
+}
@@ -0,0 +1,205 @@
+package datagrid
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const keysetCatalog = `{
+	"version": "2.0",
+	"title": "Staff",
+	"objects": [{"name": "app.staff", "columns": [
+		{"name": "id", "type": "integer", "primary_key": true},
+		{"name": "name", "type": "text"},
+		{"name": "salary", "type": "numeric"}
+	]}],
+	"datagrid": {
+		"pagination": "keyset",
+		"columns": {"id": {}, "name": {}, "salary": {}}
+	}
+}`
+
+func keysetHandler(t *testing.T) *Handler {
+	t.Helper()
+	h, err := NewHandlerFromData(nil, []byte(keysetCatalog), "en")
+	if err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	return h
+}
+
+func strp(s string) *string { return &s }
+
+func TestKeysetColumns(t *testing.T) {
+	h := keysetHandler(t)
+	tests := []struct {
+		sort  []string
+		order string
+		casts []string
+	}{
+		{nil, `ORDER BY id DESC NULLS FIRST`, []string{"integer"}},
+		{[]string{"name"}, `ORDER BY "name" ASC NULLS LAST, "id" ASC NULLS LAST`, []string{"text", "integer"}},
+		{[]string{"salary:desc,name"}, `ORDER BY "salary" DESC NULLS FIRST, "name" ASC NULLS LAST, "id" ASC NULLS LAST`, []string{"numeric", "text", "integer"}},
+		{[]string{"salary:desc nulls last"}, `ORDER BY "salary" DESC NULLS LAST, "id" ASC NULLS LAST`, []string{"numeric", "integer"}},
+		{[]string{"id:asc"}, `ORDER BY "id" ASC NULLS LAST`, []string{"integer"}},
+	}
+	for _, tt := range tests {
+		ks := h.keyset(RequestParams{Limit: 10, Sort: tt.sort})
+		if ks == nil {
+			t.Fatalf("%v: keyset disabled", tt.sort)
+		}
+		if got := ks.order(); got != tt.order {
+			t.Errorf("%v: order = %s, want %s", tt.sort, got, tt.order)
+		}
+		var casts []string
+		for _, kc := range ks.cols {
+			casts = append(casts, kc.Cast)
+		}
+		if !reflect.DeepEqual(casts, tt.casts) {
+			t.Errorf("%v: casts = %v, want %v", tt.sort, casts, tt.casts)
+		}
+	}
+
+	if h.keyset(RequestParams{}) != nil {
+		t.Error("keyset for an unpaged request")
+	}
+}
+
+func TestKeysetCursorRoundTrip(t *testing.T) {
+	h := keysetHandler(t)
+	sort := []string{"salary:desc,name"}
+	ks := h.keyset(RequestParams{Limit: 2, Sort: sort})
+	records := []map[string]interface{}{
+		{"name": "Ann", keysetAlias(0): 5000.5, keysetAlias(1): "Ann", keysetAlias(2): 7},
+		{"name": "Bob", keysetAlias(0): nil, keysetAlias(1): "Bob", keysetAlias(2): int64(42)},
+		{"name": "Cid", keysetAlias(0): nil, keysetAlias(1): "Cid", keysetAlias(2): 43},
+	}
+	page, prev, next := ks.paginate(records, 2)
+	if len(page) != 2 || prev != "" || next == "" {
+		t.Fatalf("first page: %d rows, prev %q, next %q", len(page), prev, next)
+	}
+	if _, ok := page[0][keysetAlias(0)]; ok {
+		t.Error("hidden key columns left in the records")
+	}
+
+	c, ok := decodeCursor(next)
+	if !ok {
+		t.Fatalf("next cursor %q does not decode", next)
+	}
+	if c.Dir != "n" || c.Sig != ks.sig || !reflect.DeepEqual(c.Key, []*string{nil, strp("Bob"), strp("42")}) {
+		t.Errorf("next cursor = %+v", c)
+	}
+
+	forward := h.keyset(RequestParams{Limit: 2, Sort: sort, Cursor: next})
+	if forward.backward || !reflect.DeepEqual(forward.after, c.Key) {
+		t.Errorf("next page seeks from %v (backward %v), want %v", forward.after, forward.backward, c.Key)
+	}
+	page, prev, next = forward.paginate([]map[string]interface{}{
+		{keysetAlias(0): nil, keysetAlias(1): "Cid", keysetAlias(2): 43},
+	}, 2)
+	if len(page) != 1 || prev == "" || next != "" {
+		t.Fatalf("last page: %d rows, prev %q, next %q", len(page), prev, next)
+	}
+	back := h.keyset(RequestParams{Limit: 2, Sort: sort, Cursor: prev})
+	if !back.backward || !reflect.DeepEqual(back.after, []*string{nil, strp("Cid"), strp("43")}) {
+		t.Errorf("prev page seeks from %v (backward %v)", back.after, back.backward)
+	}
+}
+
+func TestKeysetSeek(t *testing.T) {
+	h := keysetHandler(t)
+	tests := []struct {
+		name     string
+		backward bool
+		after    []*string
+		sql      string
+		args     []interface{}
+	}{
+		{
+			"forward", false, []*string{strp("5000"), strp("Ann"), strp("7")},
+			`((src."salary" < $1::numeric) OR (src."salary" = $2::numeric AND (src."name" > $3::text OR src."name" IS NULL)) OR (src."salary" = $4::numeric AND src."name" = $5::text AND (src."id" > $6::integer OR src."id" IS NULL)))`,
+			[]interface{}{"5000", "5000", "Ann", "5000", "Ann", "7"},
+		},
+		{
+			"backward", true, []*string{strp("5000"), strp("Ann"), strp("7")},
+			`(((src."salary" > $1::numeric OR src."salary" IS NULL)) OR (src."salary" = $2::numeric AND src."name" < $3::text) OR (src."salary" = $4::numeric AND src."name" = $5::text AND src."id" < $6::integer))`,
+			[]interface{}{"5000", "5000", "Ann", "5000", "Ann", "7"},
+		},
+		{
+			"null key", false, []*string{nil, strp("Bob"), strp("42")},
+			`((src."salary" IS NOT NULL) OR (src."salary" IS NULL AND (src."name" > $1::text OR src."name" IS NULL)) OR (src."salary" IS NULL AND src."name" = $2::text AND (src."id" > $3::integer OR src."id" IS NULL)))`,
+			[]interface{}{"Bob", "Bob", "42"},
+		},
+		{
+			"tampered value", false, []*string{strp("0) OR 1=1 --"), strp("x"), strp("1")},
+			`((src."salary" < $1::numeric) OR (src."salary" = $2::numeric AND (src."name" > $3::text OR src."name" IS NULL)) OR (src."salary" = $4::numeric AND src."name" = $5::text AND (src."id" > $6::integer OR src."id" IS NULL)))`,
+			[]interface{}{"0) OR 1=1 --", "0) OR 1=1 --", "x", "0) OR 1=1 --", "x", "1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks := h.keyset(RequestParams{Limit: 10, Sort: []string{"salary:desc,name"}})
+			ks.backward, ks.after = tt.backward, tt.after
+			b := &whereBuilder{ph: positionalArgs(1)}
+			ks.seek(b)
+			if got := b.predicate().SQL; got != tt.sql {
+				t.Errorf("seek =\n%s\nwant\n%s", got, tt.sql)
+			}
+			if !reflect.DeepEqual(b.args, tt.args) {
+				t.Errorf("args = %v, want %v", b.args, tt.args)
+			}
+		})
+	}
+
+	// Backward from a NULL that sorts last: nothing precedes it on that column
+	ks := h.keyset(RequestParams{Limit: 10, Sort: []string{"salary:asc"}})
+	ks.backward, ks.after = true, []*string{nil, strp("1")}
+	b := &whereBuilder{ph: positionalArgs(1)}
+	ks.seek(b)
+	if want := `((src."salary" IS NOT NULL) OR (src."salary" IS NULL AND src."id" < $1::integer))`; b.predicate().SQL != want {
+		t.Errorf("seek = %s, want %s", b.predicate().SQL, want)
+	}
+}
+
+func TestKeysetInvalidCursor(t *testing.T) {
+	h := keysetHandler(t)
+	sort := []string{"name"}
+	ks := h.keyset(RequestParams{Limit: 10, Sort: sort})
+	valid := ks.cursor("n", map[string]interface{}{keysetAlias(0): "Ann", keysetAlias(1): 1})
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name   string
+		cursor string
+		sort   []string
+	}{
+		{"empty", "", sort},
+		{"not base64", "!!!", sort},
+		{"not json", encode("d=n"), sort},
+		{"unknown direction", encode(`{"d":"x","s":"` + ks.sig + `","k":["Ann","1"]}`), sort},
+		{"wrong signature", encode(`{"d":"n","s":"00000000","k":["Ann","1"]}`), sort},
+		{"short key", encode(`{"d":"n","s":"` + ks.sig + `","k":["Ann"]}`), sort},
+		{"long key", encode(`{"d":"n","s":"` + ks.sig + `","k":["Ann","1","2"]}`), sort},
+		{"other ordering", valid, []string{"salary"}},
+		{"truncated", valid[:len(valid)/2], sort},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks := h.keyset(RequestParams{Limit: 10, Sort: tt.sort, Cursor: tt.cursor})
+			if ks.after != nil || ks.backward {
+				t.Errorf("cursor accepted: after %v, backward %v", ks.after, ks.backward)
+			}
+			b := &whereBuilder{ph: positionalArgs(1)}
+			ks.seek(b)
+			if len(b.clauses) != 0 {
+				t.Errorf("first page seeks: %s", strings.Join(b.clauses, " AND "))
+			}
+		})
+	}
+
+	if ks := h.keyset(RequestParams{Limit: 10, Sort: sort, Cursor: valid}); ks.after == nil {
+		t.Error("valid cursor rejected")
+	}
+}
@@ -0,0 +1,172 @@
+package datagrid
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// isLOVInput reports whether the input type is populated from a LOV query.
+func isLOVInput(itype string) bool {
+	return itype == "lov" || itype == "lov-multi" || itype == "lov-tree" || itype == "lov-grouped"
+}
+
+// lovDependencies returns the names of the other parameters referenced as :name in
+// the parameter's LOV query. Explicit depends_on wins over detection.
+func (p QueryParam) lovDependencies(all []QueryParam) []string {
+	if len(p.DependsOn) > 0 {
+		return p.DependsOn
+	}
+	lovSQL := p.resolvedLOVQuery()
+	if lovSQL == "" {
+		return nil
+	}
+	_, names := rewriteNamedParams(lovSQL, 1, func(string) string { return "" }, func(name string) bool {
+		_, _, ok := findParam(all, name)
+		return ok
+	})
+
+	var deps []string
+	for _, name := range names {
+		other, _, ok := findParam(all, name)
+		if ok && other.Name != p.Name && other.InputType() != "constant" && !slices.Contains(deps, other.Name) {
+			deps = append(deps, other.Name)
+		}
+	}
+	return deps
+}
+
+// loadParamOptions runs the parameter's LOV query with values bound as $N arguments.
+// Values missing from the map fall back to the referenced parameter's default, so
+// a nil map resolves the initial options. It runs in a beginQueryTx transaction, so
+// session settings and RLS policies apply.
+func (h *Handler) loadParamOptions(ctx context.Context, p QueryParam, values map[string][]string) ([]LOVItem, error) {
+	if p.resolvedLOVQuery() == "" || !isLOVInput(p.InputType()) {
+		return p.Options, nil
+	}
+	tx, err := h.beginQueryTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	return h.queryParamOptions(ctx, tx, p, values)
+}
+
+// queryParamOptions is loadParamOptions on an open transaction. The row shape follows
+// the input type: lov-tree reads (value, label, depth), lov-grouped reads (group, value,
+// label).
+func (h *Handler) queryParamOptions(ctx context.Context, q queryer, p QueryParam, values map[string][]string) ([]LOVItem, error) {
+	itype := p.InputType()
+	lovSQL := p.resolvedLOVQuery()
+	if lovSQL == "" || !isLOVInput(itype) {
+		return p.Options, nil
+	}
+
+	query, args, err := h.bindQuery(ctx, lovSQL, values, 1)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, h.queryError(ctx, err)
+	}
+	defer rows.Close()
+	return scanLOVRows(rows, itype)
+}
+
+func scanLOVRows(rows *sql.Rows, itype string) ([]LOVItem, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	nCols := len(cols)
+
+	options := []LOVItem{}
+	for rows.Next() {
+		switch {
+		case itype == "lov-tree" && nCols >= 3:
+			var val, label string
+			var depth int
+			if err := rows.Scan(&val, &label, &depth); err == nil {
+				options = append(options, LOVItem{Value: val, Label: label, Depth: depth})
+			}
+		case itype == "lov-grouped" && nCols >= 3:
+			var group, val, label string
+			if err := rows.Scan(&group, &val, &label); err == nil {
+				options = append(options, LOVItem{Value: val, Label: label, Group: group})
+			}
+		case nCols >= 2:
+			var val, label string
+			if err := rows.Scan(&val, &label); err == nil {
+				options = append(options, LOVItem{Value: val, Label: label})
+			}
+		default:
+			var val string
+			if err := rows.Scan(&val); err == nil {
+				options = append(options, LOVItem{Value: val, Label: val})
+			}
+		}
+	}
+	return options, rows.Err()
+}
+
+// RefreshParamOptions re-resolves one parameter's Options from the current form values.
+// The returned copy also carries the submitted selection so it survives the refresh.
+func (h *Handler) RefreshParamOptions(ctx context.Context, name string, values map[string][]string) (*QueryParam, error) {
+	for _, p := range h.QueryParams {
+		if p.Name != name {
+			continue
+		}
+		opts, err := h.loadParamOptions(ctx, p, values)
+		if err != nil {
+			return nil, err
+		}
+		p.Options = opts
+		p.Selected = values[p.Name]
+		return &p, nil
+	}
+	return nil, fmt.Errorf("unknown query parameter %q", name)
+}
+
+// ServeOptions is the options-refresh endpoint for dependent (cascading) LOV parameters.
+// It reads the parameter name from "options_for" and the current form values from the
+// request, and writes the <option> fragment HTMX swaps into the dependent <select>.
+func (h *Handler) ServeOptions(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.RefreshParamOptions(r.Context(), r.Form.Get("options_for"), r.Form)
+	if err != nil {
+		slog.Error("LOV options refresh error", "param", r.Form.Get("options_for"), "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tmpl, err := template.New("datagrid_options").Funcs(TemplateFuncs()).ParseFS(UIAssets,
+		"ui/templates/partials/datagrid/params_form.html",
+	)
+	if err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := tmpl.ExecuteTemplate(w, "datagrid_param_options", p); err != nil {
+		slog.Error("datagrid render error", "error", err)
+	}
+}
+
+// optionsTrigger builds the hx-trigger that refreshes a dependent LOV when any of
+// the parameters it depends on changes, or is itself refreshed (chained LOVs).
+func optionsTrigger(p QueryParam) string {
+	var triggers []string
+	for _, dep := range p.DependsOn {
+		triggers = append(triggers, "change from:#param-"+dep, "htmx:afterSwap from:#param-"+dep)
+	}
+	return strings.Join(triggers, ", ")
+}
@@ -3,6 +3,7 @@ package datagrid
 import (
 	"encoding/json"
 	"fmt"
+	"regexp"
 	"strings"
 )
 
@@ -21,6 +22,10 @@ type UIColumn struct {
 	LOV        []LOVItem `json:"lov,omitempty"`
 	IsPivotRow bool      `json:"is_pivot_row,omitempty"`
 	IsPivotCol bool      `json:"is_pivot_col,omitempty"`
+	Range      string    `json:"range,omitempty"`     // Input type ("number", "date") of a from/to filter
+	Aggregate  string    `json:"aggregate,omitempty"` // Footer aggregate (DatagridColumnDef.Aggregate)
+	Masked     string    `json:"masked,omitempty"`    // Mask applied for the request's roles (DatagridColumnDef.Mask)
+	Editable   bool      `json:"editable,omitempty"`  // Editable in place (Handler.CellEndpoint)
 }
 
 type LOVItem struct {
@@ -46,7 +51,9 @@ type Catalog struct {
 	Datagrid    DatagridConfig `json:"datagrid,omitempty"`
 	Objects     []ObjectDef    `json:"objects,omitempty"`
 	Parameters  []QueryParam   `json:"parameters,omitempty"`
+	Rules       []ParamRule    `json:"rules,omitempty"` // Cross-field parameter checks (e.g. date_to >= date_from)
 	SQL         string         `json:"sql,omitempty"`
+	Timeout     string         `json:"timeout,omitempty"` // Statement timeout, e.g. "30s" (plain numbers are seconds)
 }
 
 type DatagridConfig struct {
@@ -60,6 +67,12 @@ type DatagridConfig struct {
 	Pivot            *PivotConfig                 `json:"pivot,omitempty"`
 	Pivot2           *Pivot2Config                `json:"pivot2,omitempty"`
 	Links            map[string]string            `json:"links,omitempty"`
+	Pagination       string                       `json:"pagination,omitempty"`     // "offset" (default) or "keyset"
+	Execution        string                       `json:"execution,omitempty"`      // "json" (default, datagrid_execute_json) or "native"
+	CountMode        string                       `json:"count_mode,omitempty"`     // exact (default), estimate, capped or none
+	CountCap         int                          `json:"count_cap,omitempty"`      // Rows counted in capped mode (default 1000)
+	Facets           bool                         `json:"facets,omitempty"`         // Count rows per LOV filter value (TableResult.Facets)
+	VersionColumn    string                       `json:"version_column,omitempty"` // Column changed by every write, checked by cell edits (default xmin)
 }
 
 type PivotConfig struct {
@@ -126,9 +139,15 @@ type PivotCSSRule struct {
 }
 
 type SearchableConfig struct {
-	Columns   []string `json:"columns"`
-	Operator  string   `json:"operator"`
-	Threshold float64  `json:"threshold"`
+	Columns   []string          `json:"columns"`
+	Operator  string            `json:"operator"`
+	Threshold float64           `json:"threshold"`
+	Config    string            `json:"config,omitempty"`    // fts: text search configuration (simple, english, hungarian, ...)
+	Weights   map[string]string `json:"weights,omitempty"`   // fts: column -> weight A-D (default D)
+	Rank      bool              `json:"rank,omitempty"`      // fts: order by ts_rank when no sort is requested
+	Headlines []string          `json:"headlines,omitempty"` // fts: columns returning <field>_headline snippets (default all)
+
+	ColumnSearch bool `json:"column_search,omitempty"` // Show a search box per column in the header
 }
 
 type DatagridDefaults struct {
@@ -148,16 +167,17 @@ type Operations struct {
 }
 
 type FilterDef struct {
-	Column string `json:"column"`
-	Type   string `json:"type"` // text, number, boolean, int_bool
+	Column    string   `json:"column"`
+	Type      string   `json:"type"`                // text, number, date, boolean, int_bool
+	Operators []string `json:"operators,omitempty"` // Allowed besides "in": not_in, gt, gte, lt, lte, between, contains, starts_with, is_null, is_not_null, date_range
 }
 
 // QueryParam describes a query parameter from the catalog JSON.
 type QueryParam struct {
 	Name            string    `json:"name"`
 	Type            string    `json:"type"`    // DATE, TEXT, INTEGER, NUMERIC, TEXT[]
-	Default         string    `json:"default"` // CURRENT_DATE, NULL, or literal
-	Input           string    `json:"input"`   // date, number, text, select, lov, lov-tree, lov-grouped, constant
+	Default         string    `json:"default"` // CURRENT_DATE, "CURRENT_DATE - 30", start_of_month, a daterange preset, NULL, or literal
+	Input           string    `json:"input"`   // date, daterange, number, text, select, lov, lov-tree, lov-grouped, constant
 	Description     string    `json:"description"`
 	Label           string    `json:"label,omitempty"`          // Display label (auto-generated from name if empty)
 	LOVQuery        string    `json:"lov_query,omitempty"`      // SQL query for lov/lov-tree/lov-grouped options
@@ -167,6 +187,17 @@ type QueryParam struct {
 	Options         []LOVItem `json:"options,omitempty"`        // Resolved at load time for select/lov
 	ResolvedDefault string    `json:"-"`                        // Resolved default for HTML inputs
 	IsArray         bool      `json:"isArray,omitempty"`        // True for array types (TEXT[], INTEGER[]) → renders multi-select
+	DependsOn       []string  `json:"depends_on,omitempty"`     // Parameters the LOV query references (auto-detected from :name when empty)
+	Selected        []string  `json:"-"`                        // Current values, kept selected when options are refreshed
+
+	// Validation, checked in Go before any SQL runs
+	Required bool   `json:"required,omitempty"`
+	Min      string `json:"min,omitempty"`       // Lower bound for numbers and dates (dates also accept CURRENT_DATE)
+	Max      string `json:"max,omitempty"`       // Upper bound for numbers and dates
+	Pattern  string `json:"pattern,omitempty"`   // Regular expression text values must match
+	MaxItems int    `json:"max_items,omitempty"` // Maximum number of selected items for array params
+
+	pattern *regexp.Regexp // Pattern, compiled when the handler is built
 }
 
 // InputType returns the HTML input type for the parameter.
@@ -175,6 +206,8 @@ func (p QueryParam) InputType() string {
 	switch {
 	case in == "date" || in == "datetime":
 		return "date"
+	case in == "daterange" || in == "date-range":
+		return "daterange"
 	case in == "number":
 		return "number"
 	case in == "lov-tree" || strings.HasPrefix(in, "lov-tree:"):
@@ -227,6 +260,9 @@ func (p QueryParam) resolvedLOVQuery() string {
 		parts := strings.SplitN(p.Input, ":", 2)
 		if len(parts) == 2 {
 			lovName := strings.TrimSpace(parts[1])
+			if strings.HasPrefix(strings.ToUpper(lovName), "SELECT") || strings.HasPrefix(strings.ToUpper(lovName), "WITH") {
+				return lovName // legacy inline SQL: "lov:SELECT ..."
+			}
 			return fmt.Sprintf("SELECT code, name FROM dwh.lov_%s()", lovName)
 		}
 	}
@@ -258,11 +294,26 @@ type DatagridColumnDef struct {
 	Icon    string            `json:"icon,omitempty"`
 	Link    string            `json:"link,omitempty"`
 	LOV     interface{}       `json:"lov,omitempty"`
+	Expr    string            `json:"expr,omitempty"` // Computed column: SQL expression over the other columns
+	Path    string            `json:"path,omitempty"` // JSON column: "<jsonb column>.<key>[.<key>...]"
+
+	Aggregate string `json:"aggregate,omitempty"` // Footer aggregate: sum, avg, min, max, count, count_distinct
+
+	Roles []string `json:"roles,omitempty"` // Roles that see the column's values; everyone when empty
+	Mask  string   `json:"mask,omitempty"`  // What other roles see: email, last4, hash, null; nothing when empty
 }
 
 type ObjectDef struct {
 	Name    string      `json:"name"`
 	Columns []ColumnDef `json:"columns"`
+	Join    *JoinDef    `json:"join,omitempty"` // Secondary objects: how they join the main object
+}
+
+// JoinDef relates a secondary object to the main object (or an earlier joined one).
+type JoinDef struct {
+	Object string            `json:"object,omitempty"` // Object joined to; the main object when empty
+	On     map[string]string `json:"on"`               // Column of Object -> column of the joined object
+	Type   string            `json:"type,omitempty"`   // left (default) or inner
 }
 
 type ColumnDef struct {
@@ -272,15 +323,30 @@ type ColumnDef struct {
 	Labels     map[string]string `json:"labels"`
 	LOV        interface{}       `json:"lov,omitempty"`
 	PrimaryKey bool              `json:"primary_key,omitempty"`
+	From       string            `json:"from,omitempty"` // Lookup column: "<object>.<column>" of a joined object
+	Expr       string            `json:"expr,omitempty"` // Computed column: SQL expression over the other columns
+	Path       string            `json:"path,omitempty"` // JSON column: "<jsonb column>.<key>[.<key>...]"
 }
 
 // RequestParams captures search, sort, and pagination from the request
 type RequestParams struct {
-	Search  string
-	Sort    []string // List of "field:dir"
-	Filters map[string][]string
-	Limit   int
-	Offset  int
+	Search       string
+	ColumnSearch map[string]string // Per-column searches (search.<field>=), keyed by field
+	Sort         []string          // List of "field:dir"
+	Filters      map[string][]string
+	Values       map[string][]string // Query-mode parameter values, keyed by QueryParam.Name
+	Query        string              // Smart-filter expression (q=), e.g. {salary} > 5000 AND {status} = Open
+	Cursor       string              // Keyset pagination token (TableResult.NextCursor / PrevCursor)
+	Limit        int
+	Offset       int
+
+	measures *measureScope // Measures the smart filter may reference (pivot views)
+	keyset   *keysetPage   // Seek state when the grid pages by key
+	probe    bool          // Fetch one row past Limit to learn whether another page follows
+	export   bool          // CSV export: only the catalog columns, no search snippets
+	access   columnAccess  // Restricted columns for the request's roles (see resolveAccess)
+	rowKey   []keyValue    // Single row addressed by its primary key (written rows read back)
+	version  bool          // Select the row version (_version) for inline edits
 }
 
 // TableResult contains data to be rendered by the partial template
@@ -313,5 +379,16 @@ type TableResult struct {
 	QueryParams     []QueryParam
 	IsQueryMode     bool
 	ExecuteEndpoint string
+	OptionsEndpoint string // Endpoint refreshing dependent LOV parameter options
 	CurrentUser     string
+	ParamErrors     []ParamError            // Failed parameter checks, shown next to each input
+	Keyset          bool                    // Paged by key: render NextCursor / PrevCursor instead of page numbers
+	NextCursor      string                  // Token of the following page, "" on the last page
+	PrevCursor      string                  // Token of the preceding page, "" on the first page
+	CountMode       string                  // How TotalCount was produced: exact, estimate, capped or none
+	CountMore       bool                    // More rows than TotalCount match (capped, none)
+	ColumnSearch    map[string]string       // Applied per-column searches, keyed by field
+	Aggregates      map[string]interface{}  // Footer aggregates over all filtered rows, keyed by field
+	Facets          map[string][]FacetCount // Rows per LOV filter value under the other filters, keyed by field
+	CellEndpoint    string                  // Inline cell edit endpoint (ServeCell); "" when cells are read-only
 }
@@ -0,0 +1,589 @@
+package datagrid
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// ExecuteQuery runs the catalog's query-mode SQL with the submitted parameter values.
+// Every :name placeholder is rewritten to a positional $N argument, so no value is
+// ever spliced into the SQL text. values is typically r.Form or r.URL.Query().
+func (h *Handler) ExecuteQuery(ctx context.Context, values map[string][]string) (*TableResult, error) {
+	if !h.IsQueryMode {
+		return nil, fmt.Errorf("catalog %q is not a query catalog", h.Catalog.Title)
+	}
+	if err := h.ValidateParams(values); err != nil {
+		return nil, err
+	}
+	p := RequestParams{}
+	if err := h.resolveAccess(ctx, &p); err != nil {
+		return nil, err
+	}
+
+	query, args, err := h.bindQuery(ctx, h.QuerySQL, values, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.access) > 0 {
+		query = fmt.Sprintf("SELECT %s FROM (%s) AS src", h.queryProjection(p.access), strings.TrimRight(strings.TrimSpace(query), ";"))
+	}
+
+	if os.Getenv("DEBUG_SQL") == "true" {
+		// Only the statement: bound values may hold personal data
+		fmt.Printf("--- QUERY SQL ---\n%s\n-----------------\n", query)
+	}
+
+	tx, err := h.beginQueryTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	records, err := h.queryRows(ctx, tx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", h.queryError(ctx, err))
+	}
+
+	h.decorateRecords(records)
+
+	p.Limit = len(records)
+	res := h.newTableResult(records, len(records), p)
+	h.fillQueryForm(res)
+	return res, tx.Commit()
+}
+
+// ExecuteQueryParams runs the query-mode SQL as a derived table, so filters, search,
+// sort and pagination from p apply to its result the same way they do for a table-backed
+// catalog. Parameter values are taken from p.Values.
+func (h *Handler) ExecuteQueryParams(ctx context.Context, p RequestParams) (*TableResult, error) {
+	source, where, args, err := h.queryStatement(ctx, &p)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := h.beginQueryTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	h.applySearchSettings(ctx, tx)
+
+	count, err := h.countRows(ctx, tx, source, where, "", args...)
+	if err != nil {
+		return nil, err
+	}
+	aggregates, err := h.aggregateRow(ctx, tx, p.access, source, where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	probe := p.Limit > 0 && count.Mode == countNone
+	pageQuery := fmt.Sprintf("SELECT %s FROM %s %s %s", h.queryProjection(p.access), source, where, h.buildOrder(p.Sort))
+	if p.Limit > 0 {
+		limit := p.Limit
+		if probe {
+			limit++ // one extra row tells whether another page follows
+		}
+		pageQuery += fmt.Sprintf(" LIMIT $%d", len(args)+1)
+		args = append(args, limit)
+	}
+	if p.Offset > 0 {
+		pageQuery += fmt.Sprintf(" OFFSET $%d", len(args)+1)
+		args = append(args, p.Offset)
+	}
+
+	if os.Getenv("DEBUG_SQL") == "true" {
+		fmt.Printf("--- QUERY SQL ---\n%s\n-----------------\n", pageQuery)
+	}
+
+	records, err := h.queryRows(ctx, tx, pageQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", h.queryError(ctx, err))
+	}
+
+	more := probe && len(records) > p.Limit
+	if more {
+		records = records[:p.Limit]
+	}
+
+	h.decorateRecords(records)
+
+	res := h.newTableResult(records, count.Total, p)
+	res.CountMode, res.CountMore = count.Mode, count.More
+	res.Aggregates = aggregates
+	if count.Mode == countNone {
+		res.TotalCount, res.CountMore = p.Offset+len(records), more
+	}
+	h.fillQueryForm(res)
+	return res, tx.Commit()
+}
+
+// fillQueryForm sets what the parameter form (params_form) of a query-mode result needs:
+// the parameters and the execute and dependent-options endpoints. Result pages carry the
+// shared options only; a host rendering the form uses QueryParamsContext instead, so
+// paging, sorting and filtering never re-run per-request LOV queries.
+func (h *Handler) fillQueryForm(res *TableResult) {
+	res.IsQueryMode = true
+	res.QueryParams = h.QueryParams
+	res.ExecuteEndpoint = h.ExecuteEndpoint
+	res.OptionsEndpoint = h.OptionsEndpoint
+	res.CurrentUser = h.CurrentUser
+}
+
+// queryStatement validates p.Values, resolves p's column access and returns the
+// query-mode SQL as a derived table (src) with the WHERE clause of p's filters and search
+// over it, and their positional arguments. The grid page and CSV export both read it.
+func (h *Handler) queryStatement(ctx context.Context, p *RequestParams) (source, where string, args []interface{}, err error) {
+	if !h.IsQueryMode {
+		return "", "", nil, fmt.Errorf("catalog %q is not a query catalog", h.Catalog.Title)
+	}
+	if err := h.ValidateParams(p.Values); err != nil {
+		return "", "", nil, err
+	}
+	if err := h.resolveAccess(ctx, p); err != nil {
+		return "", "", nil, err
+	}
+
+	query, args, err := h.bindQuery(ctx, h.QuerySQL, p.Values, 1)
+	if err != nil {
+		return "", "", nil, err
+	}
+	source = fmt.Sprintf("(%s) AS src", strings.TrimRight(strings.TrimSpace(query), ";"))
+
+	pred, err := h.compileWhere(*p, positionalArgs(len(args)+1), source)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return source, pred.Where(), append(args, pred.Args...), nil
+}
+
+// queryRecords executes query and decodes every row through to_jsonb, so records have
+// the same shape as the ones returned by datagrid_execute_json.
+func queryRecords(ctx context.Context, q queryer, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	query = strings.TrimRight(strings.TrimSpace(query), ";")
+	rows, err := q.QueryContext(ctx, fmt.Sprintf("SELECT to_jsonb(t)::text FROM (%s) AS t", query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []map[string]interface{}{}
+	for rows.Next() {
+		var rowJSON string
+		if err := rows.Scan(&rowJSON); err != nil {
+			return nil, err
+		}
+		var row map[string]interface{}
+		if err := json.Unmarshal([]byte(rowJSON), &row); err != nil {
+			return nil, err
+		}
+		records = append(records, row)
+	}
+	return records, rows.Err()
+}
+
+// bindQuery rewrites the :name placeholders of query into $N arguments (numbered from
+// argStart) and converts the submitted values according to each QueryParam.Type.
+// Server-side constants are resolved from ctx and bound the same way.
+func (h *Handler) bindQuery(ctx context.Context, query string, values map[string][]string, argStart int) (string, []interface{}, error) {
+	now := time.Now()
+	constants := make(map[string]interface{})
+	var constErr error
+	constant := func(key string) (interface{}, bool) {
+		if v, ok := constants[key]; ok {
+			return v, true
+		}
+		v, ok, err := h.resolveConstant(ctx, key)
+		if err != nil && constErr == nil {
+			constErr = err
+		}
+		if ok {
+			constants[key] = v
+		}
+		return v, ok
+	}
+
+	rewritten, names := rewriteNamedParams(query, argStart, func(name string) string {
+		if p, part, ok := findParam(h.QueryParams, name); ok {
+			switch part {
+			case "from", "to", "before":
+				return p.rangeBoundType()
+			case "range":
+				return p.rangeType()
+			}
+			return p.sqlCastType()
+		}
+		if v, ok := constant(name); ok {
+			return constantCastType(v)
+		}
+		return ""
+	}, h.isQueryParam)
+	if constErr != nil {
+		return "", nil, constErr
+	}
+
+	args := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		p, part, ok := findParam(h.QueryParams, name)
+		if !ok {
+			// Undeclared :current_user, :tenant_id etc. (e.g. in LOV queries) binds the constant
+			if v, ok := constant(name); ok {
+				args = append(args, constantArg(v))
+				continue
+			}
+			return "", nil, fmt.Errorf("unknown query parameter :%s", name)
+		}
+		if p.InputType() == "constant" {
+			v, ok := constant(p.ConstantKey())
+			if constErr != nil {
+				return "", nil, constErr
+			}
+			if !ok {
+				return "", nil, fmt.Errorf("parameter %s: no resolver for constant %q", p.Name, p.ConstantKey())
+			}
+			args = append(args, constantArg(v))
+			continue
+		}
+		if part != "" {
+			from, to, err := p.resolveRange(values, now)
+			if err != nil {
+				return "", nil, fmt.Errorf("parameter %s: %w", p.Name, err)
+			}
+			arg, err := p.bindRange(part, from, to)
+			if err != nil {
+				return "", nil, fmt.Errorf("parameter %s: %w", p.Name, err)
+			}
+			args = append(args, arg)
+			continue
+		}
+		arg, err := p.bindValue(h.paramValues(p, values))
+		if err != nil {
+			return "", nil, err
+		}
+		args = append(args, arg)
+	}
+	return rewritten, args, nil
+}
+
+// paramValues returns the raw submitted values for p, or its resolved default when
+// the parameter was not submitted at all. Constants are resolved by bindQuery.
+func (h *Handler) paramValues(p QueryParam, values map[string][]string) []string {
+	if p.InputType() == "constant" {
+		return nil
+	}
+	if v, ok := values[p.Name]; ok {
+		return v
+	}
+	if p.ResolvedDefault != "" {
+		return []string{p.ResolvedDefault}
+	}
+	return nil
+}
+
+var castTypePattern = regexp.MustCompile(`^[a-z_][a-z0-9_ ]*(\([0-9, ]+\))?$`)
+
+// sqlCastType returns the Postgres type the placeholder is cast to, e.g. "date" or "text[]".
+func (p QueryParam) sqlCastType() string {
+	t := strings.ToLower(strings.TrimSpace(p.Type))
+	isArray := p.IsArray
+	if strings.HasSuffix(t, "[]") {
+		isArray = true
+		t = strings.TrimSuffix(t, "[]")
+	}
+	if t == "" || !castTypePattern.MatchString(t) {
+		t = "text"
+	}
+	if isArray {
+		t += "[]"
+	}
+	return t
+}
+
+// bindValue converts raw form values into a driver argument for p.
+// Empty input and the literal NULL bind as SQL NULL.
+func (p QueryParam) bindValue(raw []string) (interface{}, error) {
+	castType := p.sqlCastType()
+	baseType := strings.TrimSuffix(castType, "[]")
+
+	if strings.HasSuffix(castType, "[]") {
+		var items []string
+		for _, v := range raw {
+			for _, item := range strings.Split(v, ",") {
+				item = strings.TrimSpace(item)
+				if item == "" {
+					continue
+				}
+				if _, err := convertParamValue(baseType, item); err != nil {
+					return nil, fmt.Errorf("parameter %s: %w", p.Name, err)
+				}
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			return nil, nil
+		}
+		return pq.Array(items), nil
+	}
+
+	var val string
+	for _, v := range raw {
+		if v = strings.TrimSpace(v); v != "" {
+			val = v
+			break
+		}
+	}
+	if val == "" || strings.EqualFold(val, "NULL") {
+		return nil, nil
+	}
+	arg, err := convertParamValue(baseType, val)
+	if err != nil {
+		return nil, fmt.Errorf("parameter %s: %w", p.Name, err)
+	}
+	return arg, nil
+}
+
+// convertParamValue parses a single value for the given (lower-case, scalar) SQL type.
+func convertParamValue(sqlType, val string) (interface{}, error) {
+	switch {
+	case sqlType == "integer" || sqlType == "int" || sqlType == "bigint" || sqlType == "smallint" ||
+		sqlType == "int2" || sqlType == "int4" || sqlType == "int8":
+		n, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q", val)
+		}
+		return n, nil
+	case strings.HasPrefix(sqlType, "numeric") || strings.HasPrefix(sqlType, "decimal") ||
+		sqlType == "real" || sqlType == "float4" || sqlType == "float8" || sqlType == "double precision":
+		if _, err := strconv.ParseFloat(val, 64); err != nil {
+			return nil, fmt.Errorf("invalid number %q", val)
+		}
+		return val, nil // keep the text form so NUMERIC precision is preserved
+	case sqlType == "boolean" || sqlType == "bool":
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("invalid boolean %q", val)
+		}
+		return b, nil
+	case sqlType == "date":
+		if _, err := time.Parse("2006-01-02", val); err != nil {
+			return nil, fmt.Errorf("invalid date %q", val)
+		}
+		return val, nil
+	default:
+		return val, nil
+	}
+}
+
+// rewriteNamedParams replaces :name placeholders with ($N::type) positional arguments.
+// `::` casts, string literals (with backslash escapes in E'...'), quoted identifiers,
+// dollar-quoted bodies, comments and the `:` of array slices (arr[lo:hi]) are copied
+// verbatim, except that a slice bound naming a declared parameter (isParam; arr[1:n],
+// arr[:idx]) is bound like anywhere else. A name used more than once is bound to the
+// same position. castType returns the cast for a name, or "" to emit a bare $N. The
+// returned names are ordered by position.
+func rewriteNamedParams(query string, argStart int, castType func(name string) string, isParam func(name string) bool) (string, []string) {
+	var sb strings.Builder
+	var names []string
+	positions := make(map[string]int)
+	var brackets []bool // Open [ ... ], true for array subscripts
+
+	n := len(query)
+	// paramAt reports whether the : at i starts a declared parameter's placeholder.
+	paramAt := func(i int) bool {
+		if isParam == nil || i+1 >= n || !isIdentStart(query[i+1]) || (i > 0 && query[i-1] == ':') {
+			return false
+		}
+		j := i + 1
+		for j < n && isIdentChar(query[j]) {
+			j++
+		}
+		return isParam(query[i+1 : j])
+	}
+	// placeholder writes the positional argument for the :name at i and returns the
+	// index after the name.
+	placeholder := func(i int) int {
+		j := i + 1
+		for j < n && isIdentChar(query[j]) {
+			j++
+		}
+		name := query[i+1 : j]
+		pos, ok := positions[name]
+		if !ok {
+			pos = argStart + len(names)
+			positions[name] = pos
+			names = append(names, name)
+		}
+		if t := castType(name); t != "" {
+			fmt.Fprintf(&sb, "($%d::%s)", pos, t)
+		} else {
+			fmt.Fprintf(&sb, "$%d", pos)
+		}
+		return j
+	}
+	for i := 0; i < n; {
+		c := query[i]
+		switch {
+		case (c == 'E' || c == 'e') && i+1 < n && query[i+1] == '\'' && (i == 0 || !isIdentChar(query[i-1])):
+			// Escape string constant: \' and \\ do not end it
+			j := i + 2
+			for j < n {
+				if query[j] == '\\' {
+					j += 2
+					continue
+				}
+				if query[j] == '\'' {
+					if j+1 < n && query[j+1] == '\'' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			j = min(j+1, n)
+			sb.WriteString(query[i:j])
+			i = j
+		case c == '[':
+			brackets = append(brackets, isSubscript(query[:i]))
+			sb.WriteByte(c)
+			i++
+		case c == ']':
+			if len(brackets) > 0 {
+				brackets = brackets[:len(brackets)-1]
+			}
+			sb.WriteByte(c)
+			i++
+		case c == ':' && len(brackets) > 0 && brackets[len(brackets)-1]:
+			// Array slice bounds (arr[lo:hi]). A declared parameter is bound, as the upper
+			// bound after a separator (arr[1:n]) or as the subscript itself (arr[:idx]).
+			if !paramAt(i) {
+				sb.WriteByte(c)
+				i++
+				continue
+			}
+			if !strings.HasSuffix(strings.TrimRight(sb.String(), " \t\r\n"), "[") {
+				sb.WriteByte(c)
+			}
+			i = placeholder(i)
+		case c == '\'' || c == '"':
+			j := i + 1
+			for j < n {
+				if query[j] == c {
+					if j+1 < n && query[j+1] == c { // escaped quote
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			j = min(j+1, n)
+			sb.WriteString(query[i:j])
+			i = j
+		case c == '-' && i+1 < n && query[i+1] == '-':
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				j = n - i
+			}
+			sb.WriteString(query[i : i+j])
+			i += j
+		case c == '/' && i+1 < n && query[i+1] == '*':
+			j := strings.Index(query[i+2:], "*/")
+			end := n
+			if j >= 0 {
+				end = i + 2 + j + 2
+			}
+			sb.WriteString(query[i:end])
+			i = end
+		case c == '$':
+			// Dollar-quoted string: $$...$$ or $tag$...$tag$
+			j := i + 1
+			for j < n && (isIdentChar(query[j])) {
+				j++
+			}
+			if j < n && query[j] == '$' && (j == i+1 || !isDigit(query[i+1])) {
+				tag := query[i : j+1]
+				end := strings.Index(query[j+1:], tag)
+				if end >= 0 {
+					end = j + 1 + end + len(tag)
+				} else {
+					end = n
+				}
+				sb.WriteString(query[i:end])
+				i = end
+			} else {
+				sb.WriteByte(c)
+				i++
+			}
+		case c == ':':
+			if i+1 < n && query[i+1] == ':' { // cast
+				sb.WriteString("::")
+				i += 2
+				continue
+			}
+			if i+1 < n && isIdentStart(query[i+1]) {
+				i = placeholder(i)
+				continue
+			}
+			sb.WriteByte(c)
+			i++
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String(), names
+}
+
+// isQueryParam reports whether name is a declared query parameter or one of its range
+// parts (name_from, name_to, name_before).
+func (h *Handler) isQueryParam(name string) bool {
+	_, _, ok := findParam(h.QueryParams, name)
+	return ok
+}
+
+// isSubscript reports whether a [ following before opens an array subscript rather than
+// an ARRAY[...] constructor: it directly follows an expression, not the ARRAY keyword.
+func isSubscript(before string) bool {
+	if before == "" {
+		return false
+	}
+	switch c := before[len(before)-1]; {
+	case c == ')' || c == ']' || c == '"':
+		return true
+	case !isIdentChar(c):
+		return false
+	}
+	j := len(before)
+	for j > 0 && isIdentChar(before[j-1]) {
+		j--
+	}
+	return !strings.EqualFold(before[j:], "array")
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,143 @@
+package datagrid
+
+import (
+	"html/template"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRewriteNamedParams(t *testing.T) {
+	cast := func(name string) string {
+		if name == "d" {
+			return "date"
+		}
+		return ""
+	}
+	declared := func(name string) bool { return name == "idx" || name == "n" || name == "a" }
+	tests := []struct {
+		name  string
+		query string
+		want  string
+		names []string
+	}{
+		{"plain", "SELECT * FROM t WHERE a = :a AND b = :b", "SELECT * FROM t WHERE a = $1 AND b = $2", []string{"a", "b"}},
+		{"repeated name", "WHERE a = :a OR b = :a", "WHERE a = $1 OR b = $1", []string{"a"}},
+		{"typed", "WHERE day >= :d", "WHERE day >= ($1::date)", []string{"d"}},
+		{"cast", "SELECT :a::int, x::text", "SELECT $1::int, x::text", []string{"a"}},
+		{"string literal", "WHERE a = ':x' AND b = :b", "WHERE a = ':x' AND b = $1", []string{"b"}},
+		{"doubled quote", "WHERE a = 'it''s :x' AND b = :b", "WHERE a = 'it''s :x' AND b = $1", []string{"b"}},
+		{"escape string", `WHERE a = E'it\'s :z' AND b = :b`, `WHERE a = E'it\'s :z' AND b = $1`, []string{"b"}},
+		{"escape string backslash", `WHERE a = e'c:\\' AND b = :b`, `WHERE a = e'c:\\' AND b = $1`, []string{"b"}},
+		{"identifier ending in e", "WHERE name = :e AND type=':t'", "WHERE name = $1 AND type=':t'", []string{"e"}},
+		{"quoted identifier", `SELECT "a:b" FROM t WHERE c = :c`, `SELECT "a:b" FROM t WHERE c = $1`, []string{"c"}},
+		{"dollar quoted", "SELECT $$ :x $$, $fn$ :y $fn$ WHERE a = :a", "SELECT $$ :x $$, $fn$ :y $fn$ WHERE a = $1", []string{"a"}},
+		{"line comment", "WHERE a = :a -- :x\nAND b = :b", "WHERE a = $1 -- :x\nAND b = $2", []string{"a", "b"}},
+		{"block comment", "WHERE /* :x */ a = :a", "WHERE /* :x */ a = $1", []string{"a"}},
+		{"array slice", "SELECT arr[lo:hi], arr[1:2] FROM t WHERE a = :a", "SELECT arr[lo:hi], arr[1:2] FROM t WHERE a = $1", []string{"a"}},
+		{"nested slice", "SELECT (f(x))[lo:hi], m[1][2:3]", "SELECT (f(x))[lo:hi], m[1][2:3]", nil},
+		{"slice bound parameter", "SELECT arr[1:n], arr[ :idx], arr[lo:hi] FROM t", "SELECT arr[1:$1], arr[ $2], arr[lo:hi] FROM t", []string{"n", "idx"}},
+		{"subscript parameter", "SELECT arr[:idx:idx], m[:a:b::int], m[:a::int] FROM t", "SELECT arr[$1:$1], m[$2:b::int], m[$2::int] FROM t", []string{"idx", "a"}},
+		{"array constructor", "WHERE a = ANY(ARRAY[:a, :b])", "WHERE a = ANY(ARRAY[$1, $2])", []string{"a", "b"}},
+		{"injection in literal", "WHERE a = ':a''; DROP TABLE t; --' AND b = :b", "WHERE a = ':a''; DROP TABLE t; --' AND b = $1", []string{"b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, names := rewriteNamedParams(tt.query, 1, cast, declared)
+			if got != tt.want {
+				t.Errorf("query = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(names, tt.names) {
+				t.Errorf("names = %v, want %v", names, tt.names)
+			}
+		})
+	}
+}
+
+func TestRewriteNamedParamsArgStart(t *testing.T) {
+	got, _ := rewriteNamedParams("WHERE a = :a AND b = :b", 3, func(string) string { return "" }, nil)
+	if want := "WHERE a = $3 AND b = $4"; got != want {
+		t.Errorf("query = %q, want %q", got, want)
+	}
+}
+
+func TestQueryFormOptionsEndpoint(t *testing.T) {
+	h := &Handler{
+		IsQueryMode:     true,
+		ExecuteEndpoint: "/execute",
+		OptionsEndpoint: "/options",
+		QueryParams: []QueryParam{
+			{Name: "project", Type: "TEXT", Input: "lov", Options: []LOVItem{{Value: "P1", Label: "Project 1"}}},
+			{Name: "issue", Type: "TEXT", Input: "lov", LOVQuery: "SELECT key, summary FROM issues WHERE project = :project", DependsOn: []string{"project"}},
+		},
+	}
+	res := &TableResult{}
+	h.fillQueryForm(res)
+	if res.OptionsEndpoint != "/options" {
+		t.Fatalf("OptionsEndpoint = %q, want /options", res.OptionsEndpoint)
+	}
+
+	tmpl, err := template.New("datagrid").Funcs(TemplateFuncs()).ParseFS(UIAssets, "ui/templates/partials/datagrid/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := tmpl.ExecuteTemplate(&out, "params_form", res); err != nil {
+		t.Fatal(err)
+	}
+	html := out.String()
+	if !strings.Contains(html, `hx-get="/options"`) {
+		t.Errorf("dependent LOV does not refresh from /options:\n%s", html)
+	}
+	if strings.Contains(html, `hx-get=""`) {
+		t.Errorf("params form renders an empty hx-get:\n%s", html)
+	}
+}
+
+func TestOptionsPerRequest(t *testing.T) {
+	h := &Handler{
+		SessionSettings: []SessionSetting{
+			{Name: "role", Constant: "db_role"},
+			{Name: "app.region", Value: "eu"},
+			{Name: "app.tenant", Constant: "tenant_id"},
+		},
+		QueryParams: []QueryParam{
+			{Name: "owner", Input: "constant:current_user"},
+			{Name: "project", Type: "TEXT", Input: "lov"},
+		},
+	}
+	tests := []struct {
+		name string
+		sql  string
+		want bool
+	}{
+		{"static", "SELECT code, name FROM countries", false},
+		{"fixed setting", "SELECT code, name FROM regions WHERE region = 'app.region'", false},
+		{"other parameter", "SELECT key, summary FROM issues WHERE project = :project", false},
+		{"constant parameter", "SELECT id, name FROM projects WHERE owner = :owner", true},
+		{"unknown name", "SELECT id, name FROM projects WHERE owner = :current_user", true},
+		{"setting from constant", "SELECT id, name FROM sites WHERE tenant = current_setting('APP.TENANT')::int", true},
+		{"any setting", "SELECT id, name FROM sites WHERE region = current_setting('app.region')", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := QueryParam{Name: "lov", Input: "lov", LOVQuery: tt.sql}
+			if got := h.optionsPerRequest(p); got != tt.want {
+				t.Errorf("optionsPerRequest = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryFormKeepsSharedOptions(t *testing.T) {
+	// No DB: filling a result page must not run the per-request LOV query.
+	h := &Handler{
+		IsQueryMode: true,
+		QueryParams: []QueryParam{{Name: "site", Input: "lov", LOVQuery: "SELECT id, name FROM sites WHERE owner = :current_user"}},
+	}
+	res := &TableResult{}
+	h.fillQueryForm(res)
+	if len(res.QueryParams) != 1 || res.QueryParams[0].Options != nil {
+		t.Errorf("QueryParams = %+v, want the shared parameters", res.QueryParams)
+	}
+}
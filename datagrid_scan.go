@@ -0,0 +1,199 @@
+package datagrid
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Execution paths (datagrid.execution).
+const (
+	execJSON   = "json"   // datagrid.datagrid_execute_json: one to_jsonb document per row, decoded in Go
+	execNative = "native" // the statement itself through database/sql, scanned by column type
+)
+
+// nativeExecution reports whether grid, pivot and query-mode statements run directly
+// instead of through datagrid_execute_json. CSV export is not affected: it still goes
+// through datagrid_execute_csv (query mode: jsonb_object_to_csv_line), so the stored
+// functions stay required for exports.
+func (h *Handler) nativeExecution() bool {
+	return strings.EqualFold(strings.TrimSpace(h.Config.Execution), execNative)
+}
+
+// runStatement executes a rendered grid or pivot statement, whose JSON config (LOVs,
+// bound arguments) is $1, and returns its rows as records.
+func (h *Handler) runStatement(ctx context.Context, tx *sql.Tx, query, configJSON string) ([]map[string]interface{}, error) {
+	if h.nativeExecution() {
+		rows, err := tx.QueryContext(ctx, query, configArg(query, configJSON)...)
+		if err != nil {
+			return nil, err
+		}
+		return scanRecords(rows)
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT datagrid.datagrid_execute_json($1, $2)", query, configJSON)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []map[string]interface{}{}
+	for rows.Next() {
+		var rowJSON string
+		if err := rows.Scan(&rowJSON); err != nil {
+			return nil, err
+		}
+		var row map[string]interface{}
+		if err := json.Unmarshal([]byte(rowJSON), &row); err != nil {
+			return nil, err
+		}
+		records = append(records, row)
+	}
+	return records, rows.Err()
+}
+
+// configArg is the argument list of a statement run directly with the JSON config as $1:
+// a statement that never references $1 (no LOVs, nothing bound) accepts no argument.
+func configArg(query, configJSON string) []interface{} {
+	if !configParamPattern.MatchString(query) {
+		return nil
+	}
+	if configJSON == "" {
+		configJSON = "{}"
+	}
+	return []interface{}{configJSON}
+}
+
+// queryRows runs a query-mode statement with positional arguments on the configured
+// execution path.
+func (h *Handler) queryRows(ctx context.Context, q queryer, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	if !h.nativeExecution() {
+		return queryRecords(ctx, q, query, args...)
+	}
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+// scanRecords reads rows into records keyed by column name. Values are typed by the
+// column's database type (see nativeValue) instead of going through JSON.
+func scanRecords(rows *sql.Rows) ([]map[string]interface{}, error) {
+	defer rows.Close()
+
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	types := make([]string, len(cols))
+	for i, c := range cols {
+		types[i] = c.DatabaseTypeName()
+	}
+
+	records := []map[string]interface{}{}
+	raw := make([]interface{}, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, c := range cols {
+			row[c.Name()] = nativeValue(types[i], raw[i])
+		}
+		records = append(records, row)
+	}
+	return records, rows.Err()
+}
+
+// SQLTime is a date or timestamp read by the native execution path. It prints and
+// marshals as to_jsonb renders it ("2024-03-01", "2024-03-01T09:30:00+01:00"), so
+// templates and _json show the same text on both paths.
+type SQLTime struct {
+	time.Time
+	Layout string
+}
+
+func (t SQLTime) String() string { return t.Format(t.Layout) }
+
+func (t SQLTime) MarshalJSON() ([]byte, error) { return json.Marshal(t.String()) }
+
+// nativeValue converts a driver value by database type: integers to int64, numeric to
+// json.Number (exact), floats to float64, dates and timestamps to SQLTime, json/jsonb
+// to decoded values, arrays to []interface{} and other text to string.
+func nativeValue(dbType string, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	if strings.HasPrefix(dbType, "_") {
+		b, ok := v.([]byte)
+		if !ok {
+			return v
+		}
+		var elems []sql.NullString
+		if err := (pq.GenericArray{A: &elems}).Scan(b); err != nil {
+			return string(b)
+		}
+		out := make([]interface{}, len(elems))
+		for i, e := range elems {
+			if e.Valid {
+				out[i] = nativeValue(strings.TrimPrefix(dbType, "_"), e.String)
+			}
+		}
+		return out
+	}
+
+	switch dbType {
+	case "DATE", "TIMESTAMP", "TIMESTAMPTZ":
+		layout := map[string]string{
+			"DATE":        "2006-01-02",
+			"TIMESTAMP":   "2006-01-02T15:04:05.999999",
+			"TIMESTAMPTZ": "2006-01-02T15:04:05.999999-07:00",
+		}[dbType]
+		if t, ok := v.(time.Time); ok {
+			return SQLTime{Time: t, Layout: layout}
+		}
+	}
+
+	var s string
+	switch val := v.(type) {
+	case []byte:
+		s = string(val)
+	case string:
+		s = val
+	default:
+		return v // int64, float64, bool, time.Time
+	}
+
+	switch dbType {
+	case "INT2", "INT4", "INT8", "OID":
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case "FLOAT4", "FLOAT8":
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case "NUMERIC":
+		if json.Valid([]byte(s)) { // not NaN / Infinity
+			return json.Number(s)
+		}
+	case "BOOL":
+		return s == "t" || s == "true"
+	case "JSON", "JSONB":
+		var doc interface{}
+		if err := json.Unmarshal([]byte(s), &doc); err == nil {
+			return doc
+		}
+	}
+	return s
+}
@@ -0,0 +1,69 @@
+package datagrid
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNativeValue(t *testing.T) {
+	cet := time.FixedZone("CET", 3600)
+	tests := []struct {
+		name   string
+		dbType string
+		v      interface{}
+		want   interface{}
+	}{
+		{"null", "INT4", nil, nil},
+		{"int from text", "INT8", []byte("42"), int64(42)},
+		{"int as scanned", "INT4", int64(7), int64(7)},
+		{"float", "FLOAT8", []byte("1.5"), 1.5},
+		{"numeric keeps scale", "NUMERIC", []byte("12.50"), json.Number("12.50")},
+		{"numeric beyond float64", "NUMERIC", []byte("12345678901234567890.123456789"), json.Number("12345678901234567890.123456789")},
+		{"numeric NaN", "NUMERIC", []byte("NaN"), "NaN"},
+		{"bool", "BOOL", []byte("t"), true},
+		{"bool false", "BOOL", []byte("f"), false},
+		{"jsonb", "JSONB", []byte(`{"a": [1, "x"]}`), map[string]interface{}{"a": []interface{}{float64(1), "x"}}},
+		{"invalid json", "JSON", []byte("{"), "{"},
+		{"text", "TEXT", []byte("Pécs"), "Pécs"},
+		{"int array", "_INT4", []byte("{1,NULL,3}"), []interface{}{int64(1), nil, int64(3)}},
+		{"numeric array", "_NUMERIC", []byte("{1.50,NaN}"), []interface{}{json.Number("1.50"), "NaN"}},
+		{"text array", "_TEXT", []byte(`{"a b",c,"d,e","say \"hi\""}`), []interface{}{"a b", "c", "d,e", `say "hi"`}},
+		{"empty array", "_TEXT", []byte("{}"), []interface{}{}},
+		{"malformed array", "_INT4", []byte("{1,2"), "{1,2"},
+		{"date", "DATE", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), SQLTime{Time: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Layout: "2006-01-02"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nativeValue(tt.dbType, tt.v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("value = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	times := []struct {
+		dbType string
+		v      time.Time
+		want   string
+	}{
+		{"DATE", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "2024-03-01"},
+		{"TIMESTAMP", time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC), "2024-03-01T09:30:00"},
+		{"TIMESTAMP", time.Date(2024, 3, 1, 9, 30, 0, 250000000, time.UTC), "2024-03-01T09:30:00.25"},
+		{"TIMESTAMPTZ", time.Date(2024, 3, 1, 9, 30, 0, 0, cet), "2024-03-01T09:30:00+01:00"},
+		{"TIMESTAMPTZ", time.Date(2024, 3, 1, 9, 30, 0, 123456000, time.UTC), "2024-03-01T09:30:00.123456+00:00"},
+	}
+	for _, tt := range times {
+		got, ok := nativeValue(tt.dbType, tt.v).(SQLTime)
+		if !ok {
+			t.Errorf("%s %v: not an SQLTime", tt.dbType, tt.v)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("%s %v = %s, want %s", tt.dbType, tt.v, got, tt.want)
+		}
+		if b, _ := json.Marshal(got); string(b) != `"`+tt.want+`"` {
+			t.Errorf("%s %v marshals as %s", tt.dbType, tt.v, b)
+		}
+	}
+}
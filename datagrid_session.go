@@ -0,0 +1,99 @@
+package datagrid
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// SessionSetting is a setting applied at the start of every datagrid transaction, so
+// Row Level Security policies see who is asking: set_config(Name, value, true), i.e.
+// SET LOCAL. Name "role" switches the role like SET LOCAL ROLE; other names are custom
+// settings read by policies with current_setting('app.user', true).
+//
+// The value is the server-side constant Constant (see RegisterConstant, WithConstants,
+// Handler.Constants), resolved from the request context, or the fixed Value when
+// Constant is empty. Arrays are set in Postgres array syntax ("{a,b}").
+type SessionSetting struct {
+	Name     string // "role", "app.user", "app.tenant", ...
+	Constant string // Constant supplying the value: current_user, tenant_id, ...
+	Value    string // Fixed value when Constant is empty
+}
+
+var (
+	sessionMu       sync.RWMutex
+	sessionSettings []SessionSetting
+)
+
+// SetSessionSettings replaces the process-wide session settings. Handler.SessionSettings
+// takes precedence for a single handler.
+//
+//	datagrid.SetSessionSettings(
+//		datagrid.SessionSetting{Name: "role", Value: "dwh_reader"},
+//		datagrid.SessionSetting{Name: "app.user", Constant: "current_user"},
+//		datagrid.SessionSetting{Name: "app.tenant", Constant: "tenant_id"},
+//	)
+func SetSessionSettings(settings ...SessionSetting) {
+	sessionMu.Lock()
+	defer sessionMu.Unlock()
+	sessionSettings = append([]SessionSetting(nil), settings...)
+}
+
+func (h *Handler) sessionSettings() []SessionSetting {
+	if h.SessionSettings != nil {
+		return h.SessionSettings
+	}
+	sessionMu.RLock()
+	defer sessionMu.RUnlock()
+	return sessionSettings
+}
+
+// applySessionSettings sets the session settings for the rest of tx in one statement. A
+// constant that cannot be resolved fails the request rather than running it without the
+// setting.
+func (h *Handler) applySessionSettings(ctx context.Context, tx *sql.Tx, settings []SessionSetting) error {
+	if len(settings) == 0 {
+		return nil
+	}
+
+	calls := make([]string, len(settings))
+	args := make([]interface{}, 0, 2*len(settings))
+	for i, s := range settings {
+		name := strings.TrimSpace(s.Name)
+		if name == "" {
+			return fmt.Errorf("session setting %d has no name", i)
+		}
+		var v interface{} = s.Value
+		if s.Constant != "" {
+			val, ok, err := h.resolveConstant(ctx, s.Constant)
+			if err != nil {
+				return fmt.Errorf("session setting %s: %w", name, err)
+			}
+			if !ok {
+				return fmt.Errorf("session setting %s: unknown constant %q", name, s.Constant)
+			}
+			v = constantArg(val)
+		}
+		calls[i] = fmt.Sprintf("set_config($%d, $%d::text, true)", len(args)+1, len(args)+2)
+		args = append(args, name, v)
+	}
+
+	if _, err := tx.ExecContext(ctx, "SELECT "+strings.Join(calls, ", "), args...); err != nil {
+		return fmt.Errorf("failed to apply session settings: %w", h.queryError(ctx, err))
+	}
+	return nil
+}
+
+// fixedSessionSettings returns the settings with a fixed Value, the ones that apply to
+// every requester alike (shared LOVs loaded with the catalog).
+func fixedSessionSettings(settings []SessionSetting) []SessionSetting {
+	var fixed []SessionSetting
+	for _, s := range settings {
+		if s.Constant == "" {
+			fixed = append(fixed, s)
+		}
+	}
+	return fixed
+}
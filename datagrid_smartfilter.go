@@ -0,0 +1,605 @@
+package datagrid
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// FilterError is returned when the smart-filter expression (q=) does not parse or
+// references unknown columns. Templates render it with "datagrid_filter_error".
+type FilterError struct {
+	Query   string
+	Pos     int // 1-based character position, 0 when not tied to a position
+	Message string
+}
+
+func (e *FilterError) Error() string {
+	if e.Pos > 0 {
+		return fmt.Sprintf("invalid filter expression at position %d: %s", e.Pos, e.Message)
+	}
+	return "invalid filter expression: " + e.Message
+}
+
+// measureScope lists the aggregated measures a smart filter may reference. With groupBy
+// set (pivot2), measure conditions keep the groups of that column whose aggregates match;
+// otherwise they become the HAVING clause of the aggregating statement (pivot).
+type measureScope struct {
+	values  []PivotValueConfig
+	groupBy string
+}
+
+// Smart-filter grammar, as typed into the pivot2 search box:
+//
+//	expr    = and { OR and }
+//	and     = not { AND not }
+//	not     = NOT not | "(" expr ")" | cond
+//	cond    = ref op value | ref [NOT] IN "(" value { "," value } ")"
+//	        | ref [NOT] BETWEEN value AND value | ref [NOT] [I]LIKE value | ref IS [NOT] NULL
+//	ref     = "{" column or label "}"
+//	value   = number | 'quoted' | "quoted" | bare word | ref
+//	op      = "=" | "!=" | "<>" | "<" | "<=" | ">" | ">="
+type sfTokenKind int
+
+const (
+	sfEOF sfTokenKind = iota
+	sfRef
+	sfWord
+	sfString
+	sfOp
+	sfLParen
+	sfRParen
+	sfComma
+)
+
+type sfToken struct {
+	kind sfTokenKind
+	text string
+	pos  int
+}
+
+// keyword reports whether the token is the bare (unquoted) keyword kw.
+func (t sfToken) keyword(kw string) bool {
+	return t.kind == sfWord && strings.EqualFold(t.text, kw)
+}
+
+func lexSmartFilter(q string) ([]sfToken, error) {
+	var tokens []sfToken
+	runes := []rune(q)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '{':
+			end := i + 1
+			for end < len(runes) && runes[end] != '}' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &FilterError{Query: q, Pos: pos, Message: "unterminated {column} reference"}
+			}
+			tokens = append(tokens, sfToken{sfRef, strings.TrimSpace(string(runes[i+1 : end])), pos})
+			i = end + 1
+		case r == '\'' || r == '"':
+			var sb strings.Builder
+			end := i + 1
+			for ; end < len(runes); end++ {
+				if runes[end] == r {
+					if end+1 < len(runes) && runes[end+1] == r { // doubled quote
+						sb.WriteRune(r)
+						end++
+						continue
+					}
+					break
+				}
+				sb.WriteRune(runes[end])
+			}
+			if end == len(runes) {
+				return nil, &FilterError{Query: q, Pos: pos, Message: "unterminated string"}
+			}
+			tokens = append(tokens, sfToken{sfString, sb.String(), pos})
+			i = end + 1
+		case r == '(':
+			tokens = append(tokens, sfToken{sfLParen, "(", pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, sfToken{sfRParen, ")", pos})
+			i++
+		case r == ',':
+			tokens = append(tokens, sfToken{sfComma, ",", pos})
+			i++
+		case strings.ContainsRune("=<>!", r):
+			op := string(r)
+			if i+1 < len(runes) {
+				switch two := op + string(runes[i+1]); two {
+				case "!=", "<>", "<=", ">=":
+					op = two
+				}
+			}
+			if op == "!" {
+				return nil, &FilterError{Query: q, Pos: pos, Message: "unknown operator \"!\""}
+			}
+			tokens = append(tokens, sfToken{sfOp, op, pos})
+			i += len(op)
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune("(){},'\"=<>!", runes[end]) {
+				end++
+			}
+			tokens = append(tokens, sfToken{sfWord, string(runes[i:end]), pos})
+			i = end
+		}
+	}
+	return append(tokens, sfToken{kind: sfEOF, pos: len(runes) + 1}), nil
+}
+
+// Parsed expression nodes.
+type sfNode interface{}
+
+type sfLogical struct {
+	op          string // AND, OR
+	left, right sfNode
+}
+
+type sfNot struct {
+	expr sfNode
+}
+
+type sfValue struct {
+	text  string
+	isRef bool
+	pos   int
+}
+
+type sfCond struct {
+	ref    sfValue
+	op     string // =, !=, <, <=, >, >=, IN, BETWEEN, LIKE, ILIKE, IS NULL
+	negate bool   // NOT IN, NOT BETWEEN, NOT LIKE, IS NOT NULL
+	values []sfValue
+}
+
+// Limits on what the search box accepts, so a crafted q= cannot make the parser and the
+// compiler recurse without bound or build a huge statement.
+const (
+	maxSmartFilterLen   = 2000 // characters
+	maxSmartFilterDepth = 32   // nested parentheses and NOTs
+)
+
+type sfParser struct {
+	q      string
+	tokens []sfToken
+	i      int
+	depth  int
+}
+
+func parseSmartFilter(q string) (sfNode, error) {
+	if n := len([]rune(q)); n > maxSmartFilterLen {
+		return nil, &FilterError{Query: q, Message: fmt.Sprintf("expression is too long (%d characters, at most %d)", n, maxSmartFilterLen)}
+	}
+	tokens, err := lexSmartFilter(q)
+	if err != nil {
+		return nil, err
+	}
+	p := &sfParser{q: q, tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != sfEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	return node, nil
+}
+
+func (p *sfParser) peek() sfToken { return p.tokens[p.i] }
+
+func (p *sfParser) next() sfToken {
+	t := p.tokens[p.i]
+	if t.kind != sfEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *sfParser) errorf(t sfToken, format string, args ...interface{}) error {
+	return &FilterError{Query: p.q, Pos: t.pos, Message: fmt.Sprintf(format, args...)}
+}
+
+func (p *sfParser) parseOr() (sfNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &sfLogical{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *sfParser) parseAnd() (sfNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &sfLogical{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *sfParser) parseNot() (sfNode, error) {
+	t := p.peek()
+	if p.depth++; p.depth > maxSmartFilterDepth {
+		return nil, p.errorf(t, "expression is nested too deeply (at most %d levels)", maxSmartFilterDepth)
+	}
+	defer func() { p.depth-- }()
+	switch {
+	case t.keyword("NOT"):
+		p.next()
+		expr, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &sfNot{expr: expr}, nil
+	case t.kind == sfLParen:
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != sfRParen {
+			return nil, p.errorf(t, "missing )")
+		}
+		return expr, nil
+	case t.kind == sfRef:
+		return p.parseCond()
+	case t.kind == sfEOF:
+		return nil, p.errorf(t, "unexpected end of expression")
+	}
+	return nil, p.errorf(t, "expected {column} before %q", t.text)
+}
+
+func (p *sfParser) parseCond() (sfNode, error) {
+	ref := p.next()
+	c := &sfCond{ref: sfValue{text: ref.text, isRef: true, pos: ref.pos}}
+
+	t := p.next()
+	if t.keyword("NOT") {
+		c.negate = true
+		t = p.next()
+	}
+	switch {
+	case t.kind == sfOp && !c.negate:
+		c.op = t.text
+		if c.op == "<>" {
+			c.op = "!="
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		c.values = []sfValue{v}
+	case t.keyword("IN"):
+		c.op = "IN"
+		if lp := p.next(); lp.kind != sfLParen {
+			return nil, p.errorf(lp, "expected ( after IN")
+		}
+		for {
+			v, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			c.values = append(c.values, v)
+			sep := p.next()
+			if sep.kind == sfRParen {
+				break
+			}
+			if sep.kind != sfComma {
+				return nil, p.errorf(sep, "expected , or ) in IN list")
+			}
+		}
+	case t.keyword("BETWEEN"):
+		c.op = "BETWEEN"
+		lo, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if and := p.next(); !and.keyword("AND") {
+			return nil, p.errorf(and, "expected AND in BETWEEN")
+		}
+		hi, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		c.values = []sfValue{lo, hi}
+	case t.keyword("LIKE") || t.keyword("ILIKE"):
+		c.op = strings.ToUpper(t.text)
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		c.values = []sfValue{v}
+	case t.keyword("IS") && !c.negate:
+		c.op = "IS NULL"
+		n := p.next()
+		if n.keyword("NOT") {
+			c.negate = true
+			n = p.next()
+		}
+		if !n.keyword("NULL") {
+			return nil, p.errorf(n, "expected NULL after IS")
+		}
+	default:
+		return nil, p.errorf(t, "expected an operator after {%s}", ref.text)
+	}
+	return c, nil
+}
+
+func (p *sfParser) parseValue() (sfValue, error) {
+	t := p.next()
+	switch t.kind {
+	case sfString:
+		return sfValue{text: t.text, pos: t.pos}, nil
+	case sfRef:
+		return sfValue{text: t.text, isRef: true, pos: t.pos}, nil
+	case sfWord:
+		for _, kw := range []string{"AND", "OR", "NOT", "IN", "IS", "NULL", "LIKE", "ILIKE", "BETWEEN"} {
+			if t.keyword(kw) {
+				return sfValue{}, p.errorf(t, "expected a value, got %s", kw)
+			}
+		}
+		return sfValue{text: t.text, pos: t.pos}, nil
+	}
+	return sfValue{}, p.errorf(t, "expected a value")
+}
+
+// sfCompiler turns a parsed expression into SQL, binding every literal through the
+// request's whereBuilder.
+type sfCompiler struct {
+	h        *Handler
+	q        string
+	b        *whereBuilder
+	measures *measureScope
+}
+
+// sfOperand is a compiled reference or literal.
+type sfOperand struct {
+	sql       string
+	valueType string // filterArg type of a reference: text, number, date, boolean, int_bool
+	lov       []LOVItem
+	measure   bool
+}
+
+// compileSmartFilter adds the q= expression. Conditions on columns join the WHERE clause;
+// top-level AND terms on measures become HAVING (or a group semi-join for pivot2).
+func (h *Handler) compileSmartFilter(b *whereBuilder, q string, measures *measureScope) error {
+	if strings.TrimSpace(q) == "" {
+		return nil
+	}
+	node, err := parseSmartFilter(q)
+	if err != nil {
+		return err
+	}
+	c := &sfCompiler{h: h, q: q, b: b, measures: measures}
+
+	var terms []sfNode
+	var split func(n sfNode)
+	split = func(n sfNode) {
+		if l, ok := n.(*sfLogical); ok && l.op == "AND" {
+			split(l.left)
+			split(l.right)
+			return
+		}
+		terms = append(terms, n)
+	}
+	split(node)
+
+	var having []string
+	for _, term := range terms {
+		sql, onMeasures, err := c.compile(term)
+		if err != nil {
+			return err
+		}
+		if onMeasures {
+			having = append(having, sql)
+		} else {
+			b.add(sql)
+		}
+	}
+	if len(having) == 0 {
+		return nil
+	}
+
+	if measures.groupBy == "" {
+		b.having = append(b.having, having...)
+		return nil
+	}
+	// pivot2 aggregates in Go: keep the top-level groups whose aggregates match, computed
+	// over the same filtered rows. The subquery's src shadows the outer alias.
+	group := h.columnExpr(measures.groupBy)
+	inner := ""
+	if len(b.clauses) > 0 {
+		inner = " WHERE " + strings.Join(b.clauses, " AND ")
+	}
+	b.add(fmt.Sprintf("%s IN (SELECT %s FROM %s%s GROUP BY %s HAVING %s)",
+		group, group, b.source, inner, group, strings.Join(having, " AND ")))
+	return nil
+}
+
+// compile returns the SQL of n and whether it references measures. Columns and measures
+// cannot be mixed below a top-level AND, as they filter at different levels.
+func (c *sfCompiler) compile(n sfNode) (string, bool, error) {
+	switch n := n.(type) {
+	case *sfLogical:
+		l, lm, err := c.compile(n.left)
+		if err != nil {
+			return "", false, err
+		}
+		r, rm, err := c.compile(n.right)
+		if err != nil {
+			return "", false, err
+		}
+		if lm != rm {
+			return "", false, &FilterError{Query: c.q, Message: fmt.Sprintf("measure and column conditions cannot be combined with %s", n.op)}
+		}
+		return "(" + l + " " + n.op + " " + r + ")", lm, nil
+	case *sfNot:
+		s, m, err := c.compile(n.expr)
+		if err != nil {
+			return "", false, err
+		}
+		return "NOT (" + s + ")", m, nil
+	case *sfCond:
+		return c.compileCond(n)
+	}
+	return "", false, fmt.Errorf("unexpected filter node %T", n)
+}
+
+func (c *sfCompiler) compileCond(n *sfCond) (string, bool, error) {
+	ref, err := c.resolve(n.ref)
+	if err != nil {
+		return "", false, err
+	}
+	vals := make([]string, len(n.values))
+	for i, v := range n.values {
+		if vals[i], err = c.operand(ref, v, n.op); err != nil {
+			return "", false, err
+		}
+	}
+
+	not := ""
+	if n.negate {
+		not = "NOT "
+	}
+	var sql string
+	switch n.op {
+	case "IS NULL":
+		sql = fmt.Sprintf("%s IS %sNULL", ref.sql, not)
+	case "IN":
+		sql = fmt.Sprintf("%s %sIN (%s)", ref.sql, not, strings.Join(vals, ", "))
+	case "BETWEEN":
+		sql = fmt.Sprintf("%s %sBETWEEN %s AND %s", ref.sql, not, vals[0], vals[1])
+	case "LIKE", "ILIKE":
+		sql = fmt.Sprintf("(%s)::text %s%s %s", ref.sql, not, n.op, vals[0])
+	default:
+		sql = fmt.Sprintf("%s %s %s", ref.sql, n.op, vals[0])
+	}
+	return sql, ref.measure, nil
+}
+
+// operand compiles the right-hand side of a condition: another reference, or a literal
+// bound with the type of the left-hand reference. A LOV label is accepted for its code.
+func (c *sfCompiler) operand(ref sfOperand, v sfValue, op string) (string, error) {
+	if v.isRef {
+		other, err := c.resolve(v)
+		if err != nil {
+			return "", err
+		}
+		if other.measure != ref.measure {
+			return "", &FilterError{Query: c.q, Pos: v.pos, Message: "cannot compare a measure with a column"}
+		}
+		return other.sql, nil
+	}
+	if op == "LIKE" || op == "ILIKE" {
+		return c.b.bind(v.text, "text"), nil
+	}
+
+	text := v.text
+	for _, item := range ref.lov {
+		if code := fmt.Sprintf("%v", item.Value); code != text && strings.EqualFold(item.Label, text) {
+			text = code
+			break
+		}
+	}
+	arg, cast, ok := filterArg(ref.valueType, text)
+	if !ok || (ref.valueType == "boolean" || ref.valueType == "int_bool") && !isBoolLiteral(text) {
+		return "", &FilterError{Query: c.q, Pos: v.pos, Message: fmt.Sprintf("%q is not a valid %s", v.text, ref.valueType)}
+	}
+	return c.b.bind(arg, cast), nil
+}
+
+func isBoolLiteral(s string) bool {
+	switch strings.ToLower(s) {
+	case "true", "false", "1", "0":
+		return true
+	}
+	return false
+}
+
+// resolve looks a {reference} up among the columns (by field, then label) and, when the
+// statement aggregates, the measures (by label, then column).
+func (c *sfCompiler) resolve(v sfValue) (sfOperand, error) {
+	for _, byLabel := range []bool{false, true} {
+		for _, col := range c.h.Columns {
+			name := col.Field
+			if byLabel {
+				name = col.Label
+			}
+			if strings.EqualFold(name, v.text) {
+				if c.h.restrictedField(c.b.access, col.Field) {
+					return sfOperand{}, &FilterError{Query: c.q, Pos: v.pos, Message: fmt.Sprintf("column {%s} is not available", v.text)}
+				}
+				return sfOperand{sql: c.h.columnExpr(col.Field), valueType: smartValueType(col.Type), lov: col.LOV}, nil
+			}
+		}
+	}
+	if c.measures != nil {
+		for _, m := range c.measures.values {
+			label := m.Label
+			if label == "" {
+				label = fmt.Sprintf("%s(%s)", m.Func, m.Column)
+			}
+			if !strings.EqualFold(label, v.text) && !strings.EqualFold(m.Column, v.text) {
+				continue
+			}
+			if c.h.restrictedField(c.b.access, m.Column) {
+				return sfOperand{}, &FilterError{Query: c.q, Pos: v.pos, Message: fmt.Sprintf("measure {%s} is not available", v.text)}
+			}
+			if m.Expr != "" || m.Column == "" {
+				return sfOperand{}, &FilterError{Query: c.q, Pos: v.pos, Message: fmt.Sprintf("computed measure {%s} cannot be filtered", v.text)}
+			}
+			return sfOperand{sql: c.h.measureSQL(m), valueType: "number", measure: true}, nil
+		}
+	}
+	return sfOperand{}, &FilterError{Query: c.q, Pos: v.pos, Message: fmt.Sprintf("unknown column {%s}", v.text)}
+}
+
+// measureSQL renders the aggregate of a pivot measure, as the pivot statement computes it.
+func (h *Handler) measureSQL(m PivotValueConfig) string {
+	fn := strings.ToUpper(strings.TrimSpace(m.Func))
+	if fn == "" {
+		fn = "SUM"
+	}
+	if fn == "COUNT DISTINCT" {
+		return fmt.Sprintf("COUNT(DISTINCT %s)", h.columnExpr(m.Column))
+	}
+	return fmt.Sprintf("%s(%s)", fn, h.columnExpr(m.Column))
+}
+
+// smartValueType maps a column type to the filterArg type its literals are bound with.
+func smartValueType(colType string) string {
+	t := strings.ToLower(colType)
+	switch {
+	case t == "int_bool":
+		return "int_bool"
+	case t == "bool" || t == "boolean":
+		return "boolean"
+	case strings.HasPrefix(t, "date") || strings.HasPrefix(t, "timestamp"):
+		return "date"
+	case isNumericType(t) && !strings.Contains(t, "interval"):
+		return "number"
+	}
+	return "text"
+}
@@ -0,0 +1,307 @@
+package datagrid
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLexSmartFilter(t *testing.T) {
+	tests := []struct {
+		q    string
+		want []string // kind:text
+	}{
+		{"{Name} = 'Ann'", []string{"ref:Name", "op:=", "str:Ann"}},
+		{"{ Salary }>=1000", []string{"ref:Salary", "op:>=", "word:1000"}},
+		{"{a}<>{b}", []string{"ref:a", "op:<>", "ref:b"}},
+		{"{a} != 1", []string{"ref:a", "op:!=", "word:1"}},
+		{`{a} = 'it''s'`, []string{"ref:a", "op:=", "str:it's"}},
+		{`{a} = "say ""hi"""`, []string{"ref:a", "op:=", `str:say "hi"`}},
+		{"{a} IN (1,2)", []string{"ref:a", "word:IN", "(", "word:1", ",", "word:2", ")"}},
+		{"{a} = x::int", []string{"ref:a", "op:=", "word:x::int"}},
+		{"{a} = $$x$$", []string{"ref:a", "op:=", "word:$$x$$"}},
+		{"{a} = '1; DROP TABLE t; --'", []string{"ref:a", "op:=", "str:1; DROP TABLE t; --"}},
+		{"{Név} = 'Árvíztűrő'", []string{"ref:Név", "op:=", "str:Árvíztűrő"}},
+	}
+	kinds := map[sfTokenKind]string{sfRef: "ref", sfWord: "word", sfString: "str", sfOp: "op"}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			tokens, err := lexSmartFilter(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if last := tokens[len(tokens)-1]; last.kind != sfEOF {
+				t.Fatalf("last token = %v, want EOF", last)
+			}
+			var got []string
+			for _, tok := range tokens[:len(tokens)-1] {
+				if k, ok := kinds[tok.kind]; ok {
+					got = append(got, k+":"+tok.text)
+				} else {
+					got = append(got, tok.text)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tokens = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLexSmartFilterErrors(t *testing.T) {
+	tests := []struct {
+		q   string
+		pos int
+	}{
+		{"{Name = 'x'", 1},
+		{"{a} = 'open", 7},
+		{`{a} = "open`, 7},
+		{"{a} ! 1", 5},
+	}
+	for _, tt := range tests {
+		_, err := lexSmartFilter(tt.q)
+		var ferr *FilterError
+		if !errors.As(err, &ferr) {
+			t.Errorf("%q: err = %v, want *FilterError", tt.q, err)
+			continue
+		}
+		if ferr.Pos != tt.pos {
+			t.Errorf("%q: pos = %d, want %d", tt.q, ferr.Pos, tt.pos)
+		}
+	}
+}
+
+// renderSmartFilter renders a parsed expression with explicit grouping.
+func renderSmartFilter(n sfNode) string {
+	switch n := n.(type) {
+	case *sfLogical:
+		return "(" + renderSmartFilter(n.left) + " " + n.op + " " + renderSmartFilter(n.right) + ")"
+	case *sfNot:
+		return "NOT " + renderSmartFilter(n.expr)
+	case *sfCond:
+		vals := make([]string, len(n.values))
+		for i, v := range n.values {
+			vals[i] = v.text
+			if v.isRef {
+				vals[i] = "{" + v.text + "}"
+			}
+		}
+		not := ""
+		if n.negate {
+			not = "NOT "
+		}
+		if n.op == "IS NULL" {
+			return fmt.Sprintf("{%s} IS %sNULL", n.ref.text, not)
+		}
+		return fmt.Sprintf("{%s} %s%s %s", n.ref.text, not, n.op, strings.Join(vals, ","))
+	}
+	return fmt.Sprintf("%T", n)
+}
+
+func TestParseSmartFilter(t *testing.T) {
+	tests := []struct {
+		q    string
+		want string
+	}{
+		{"{a} = 1", "{a} = 1"},
+		{"{a} <> 1", "{a} != 1"},
+		{"{a} = 1 OR {b} = 2 AND {c} = 3", "({a} = 1 OR ({b} = 2 AND {c} = 3))"},
+		{"{a} = 1 AND {b} = 2 OR {c} = 3", "(({a} = 1 AND {b} = 2) OR {c} = 3)"},
+		{"({a} = 1 OR {b} = 2) AND {c} = 3", "(({a} = 1 OR {b} = 2) AND {c} = 3)"},
+		{"{a} = 1 AND {b} = 2 AND {c} = 3", "(({a} = 1 AND {b} = 2) AND {c} = 3)"},
+		{"NOT {a} = 1 AND {b} = 2", "(NOT {a} = 1 AND {b} = 2)"},
+		{"NOT ({a} = 1 OR {b} = 2)", "NOT ({a} = 1 OR {b} = 2)"},
+		{"{a} not in (1, 'x', {b})", "{a} NOT IN 1,x,{b}"},
+		{"{a} BETWEEN 1 AND 5 AND {b} = 2", "({a} BETWEEN 1,5 AND {b} = 2)"},
+		{"{a} NOT ILIKE 'x%'", "{a} NOT ILIKE x%"},
+		{"{a} is not null or {b} IS NULL", "({a} IS NOT NULL OR {b} IS NULL)"},
+		{"{a} = {b}", "{a} = {b}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			n, err := parseSmartFilter(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := renderSmartFilter(n); got != tt.want {
+				t.Errorf("parsed = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSmartFilterErrors(t *testing.T) {
+	tests := []struct {
+		q       string
+		pos     int
+		message string
+	}{
+		{"", 1, "unexpected end of expression"},
+		{"{a}", 4, "expected an operator after {a}"},
+		{"{a} = ", 7, "expected a value"},
+		{"{a} = AND", 7, "expected a value, got AND"},
+		{"a = 1", 1, `expected {column} before "a"`},
+		{"({a} = 1", 9, "missing )"},
+		{"{a} = 1)", 8, `unexpected ")"`},
+		{"{a} IN 1", 8, "expected ( after IN"},
+		{"{a} IN (1 2)", 11, "expected , or ) in IN list"},
+		{"{a} BETWEEN 1 OR 2", 15, "expected AND in BETWEEN"},
+		{"{a} IS 1", 8, "expected NULL after IS"},
+		{"{a} NOT = 1", 9, "expected an operator after {a}"},
+		{"{a} = 1; DROP TABLE t", 10, `unexpected "DROP"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			_, err := parseSmartFilter(tt.q)
+			var ferr *FilterError
+			if !errors.As(err, &ferr) {
+				t.Fatalf("err = %v, want *FilterError", err)
+			}
+			if ferr.Pos != tt.pos || ferr.Message != tt.message {
+				t.Errorf("error at %d %q, want at %d %q", ferr.Pos, ferr.Message, tt.pos, tt.message)
+			}
+		})
+	}
+}
+
+func TestParseSmartFilterLimits(t *testing.T) {
+	nested := func(n int) string {
+		return strings.Repeat("(", n) + "{a} = 1" + strings.Repeat(")", n)
+	}
+	if _, err := parseSmartFilter(nested(maxSmartFilterDepth - 1)); err != nil {
+		t.Errorf("%d nested parentheses: %v", maxSmartFilterDepth-1, err)
+	}
+	long := strings.Repeat("{a} = 1 AND ", maxSmartFilterLen/12+1) + "{a} = 1"
+	tests := []struct {
+		name    string
+		q       string
+		message string
+	}{
+		{"parentheses", nested(maxSmartFilterDepth), "expression is nested too deeply (at most 32 levels)"},
+		{"NOTs", strings.Repeat("NOT ", 40) + "{a} = 1", "expression is nested too deeply (at most 32 levels)"},
+		{"length", long, fmt.Sprintf("expression is too long (%d characters, at most %d)", len(long), maxSmartFilterLen)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseSmartFilter(tt.q)
+			var ferr *FilterError
+			if !errors.As(err, &ferr) {
+				t.Fatalf("err = %v, want *FilterError", err)
+			}
+			if ferr.Message != tt.message {
+				t.Errorf("message = %q, want %q", ferr.Message, tt.message)
+			}
+		})
+	}
+}
+
+func smartFilterHandler() *Handler {
+	return &Handler{Columns: []UIColumn{
+		{Field: "name", Label: "Name", Type: "text"},
+		{Field: "salary", Label: "Salary", Type: "numeric"},
+		{Field: "hired", Label: "Hired", Type: "date"},
+		{Field: "active", Label: "Active", Type: "boolean"},
+		{Field: "status", Label: "Status", Type: "text", LOV: []LOVItem{{Value: "A", Label: "Active"}, {Value: "T", Label: "Terminated"}}},
+	}}
+}
+
+func TestCompileSmartFilter(t *testing.T) {
+	tests := []struct {
+		q    string
+		sql  string
+		args []interface{}
+	}{
+		{"{name} = 'Ann'", `src."name" = $1::text`, []interface{}{"Ann"}},
+		{"{Name} = Ann", `src."name" = $1::text`, []interface{}{"Ann"}},
+		{"{salary} >= 1000", `src."salary" >= $1::numeric`, []interface{}{json.Number("1000")}},
+		{"{hired} < '2024-01-31'", `src."hired" < $1::date`, []interface{}{"2024-01-31"}},
+		{"{active} = true", `src."active" = $1::boolean`, []interface{}{true}},
+		{"{Status} = Terminated", `src."status" = $1::text`, []interface{}{"T"}},
+		{"{status} IN ('A', 'Terminated')", `src."status" IN ($1::text, $2::text)`, []interface{}{"A", "T"}},
+		{"{salary} NOT BETWEEN 1 AND 2", `src."salary" NOT BETWEEN $1::numeric AND $2::numeric`, []interface{}{json.Number("1"), json.Number("2")}},
+		{"{name} ILIKE 'a%'", `(src."name")::text ILIKE $1::text`, []interface{}{"a%"}},
+		{"{name} IS NOT NULL", `src."name" IS NOT NULL`, nil},
+		{"{name} = {status}", `src."name" = src."status"`, nil},
+		{"{name} = 'a' OR {salary} > 1 AND NOT {active} = false",
+			`(src."name" = $1::text OR (src."salary" > $2::numeric AND NOT (src."active" = $3::boolean)))`,
+			[]interface{}{"a", json.Number("1"), false}},
+		{"{name} = 'x'' OR 1=1 --'", `src."name" = $1::text`, []interface{}{"x' OR 1=1 --"}},
+		{"{name} = '$$; DROP TABLE t; $$'", `src."name" = $1::text`, []interface{}{"$$; DROP TABLE t; $$"}},
+		{"{name} = x::int", `src."name" = $1::text`, []interface{}{"x::int"}},
+	}
+	h := smartFilterHandler()
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			b := &whereBuilder{ph: positionalArgs(1)}
+			if err := h.compileSmartFilter(b, tt.q, nil); err != nil {
+				t.Fatal(err)
+			}
+			p := b.predicate()
+			if p.SQL != tt.sql {
+				t.Errorf("sql = %s, want %s", p.SQL, tt.sql)
+			}
+			if !reflect.DeepEqual(p.Args, tt.args) {
+				t.Errorf("args = %#v, want %#v", p.Args, tt.args)
+			}
+		})
+	}
+}
+
+func TestCompileSmartFilterErrors(t *testing.T) {
+	tests := []struct {
+		q       string
+		message string
+	}{
+		{"{nosuch} = 1", "unknown column {nosuch}"},
+		{"{salary} = abc", `"abc" is not a valid number`},
+		{"{salary} = '1; DROP TABLE t'", `"1; DROP TABLE t" is not a valid number`},
+		{"{active} = maybe", `"maybe" is not a valid boolean`},
+		{"{hired} = someday", `"someday" is not a valid date`},
+		{`{name"; DROP TABLE t; --} = 1`, `unknown column {name"; DROP TABLE t; --}`},
+		{"{Status} = 'A'", "column {Status} is not available"},
+	}
+	h := smartFilterHandler()
+	for _, tt := range tests {
+		t.Run(tt.q, func(t *testing.T) {
+			b := &whereBuilder{ph: positionalArgs(1), access: columnAccess{"status": ""}}
+			err := h.compileSmartFilter(b, tt.q, nil)
+			var ferr *FilterError
+			if !errors.As(err, &ferr) {
+				t.Fatalf("err = %v, want *FilterError", err)
+			}
+			if ferr.Message != tt.message {
+				t.Errorf("message = %q, want %q", ferr.Message, tt.message)
+			}
+			if len(b.clauses) != 0 {
+				t.Errorf("clauses = %v, want none", b.clauses)
+			}
+		})
+	}
+}
+
+func TestCompileSmartFilterMeasures(t *testing.T) {
+	h := smartFilterHandler()
+	measures := &measureScope{values: []PivotValueConfig{{Column: "salary", Func: "sum", Label: "Total"}}}
+
+	b := &whereBuilder{ph: positionalArgs(1)}
+	if err := h.compileSmartFilter(b, "{Total} > 100 AND {name} = 'a'", measures); err != nil {
+		t.Fatal(err)
+	}
+	p := b.predicate()
+	if want := `src."name" = $2::text`; p.SQL != want {
+		t.Errorf("sql = %s, want %s", p.SQL, want)
+	}
+	if want := `SUM(src."salary") > $1::numeric`; p.Having != want {
+		t.Errorf("having = %s, want %s", p.Having, want)
+	}
+
+	b = &whereBuilder{ph: positionalArgs(1)}
+	err := h.compileSmartFilter(b, "{Total} > 100 OR {name} = 'a'", measures)
+	var ferr *FilterError
+	if !errors.As(err, &ferr) || ferr.Message != "measure and column conditions cannot be combined with OR" {
+		t.Errorf("err = %v, want a measure/column OR error", err)
+	}
+}
@@ -1,6 +1,8 @@
 package datagrid
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -9,7 +11,18 @@ import (
 
 // BuildGridSQL generates the SQL query and JSON configuration for the grid execution.
 func (h *Handler) BuildGridSQL(p RequestParams) (string, string, error) {
+	query, configJSON, _, err := h.buildGridSQL(p)
+	return query, configJSON, err
+}
+
+// buildGridSQL is BuildGridSQL that also returns the compiled predicate, so the
+// COUNT(*) can reuse exactly the same WHERE clause and config.
+func (h *Handler) buildGridSQL(p RequestParams) (string, string, Predicate, error) {
+	h.ensureAccess(&p)
 	order := h.buildOrder(p.Sort)
+	if p.keyset != nil {
+		order = p.keyset.order()
+	}
 
 	// Build JSON config for SQL generation
 	type ColDecl struct {
@@ -26,6 +39,7 @@ func (h *Handler) BuildGridSQL(p RequestParams) (string, string, error) {
 		ValuesJSON string     `json:"valuesJSON,omitempty"`
 		IsBoolean  bool       `json:"-"`
 		IsNumber   bool       `json:"-"`
+		Source     string     `json:"-"` // SQL expression of the column
 	}
 
 	config := make(map[string]interface{})
@@ -37,12 +51,23 @@ func (h *Handler) BuildGridSQL(p RequestParams) (string, string, error) {
 	colsDecl := []ColDecl{}
 	lovsDecl := []LOVDecl{}
 
+	if p.keyset != nil {
+		// Key values as text, turned into the cursor tokens of the page
+		for i, kc := range p.keyset.cols {
+			colsDecl = append(colsDecl, ColDecl{Name: "(" + kc.SQL + ")::text", Alias: keysetAlias(i)})
+		}
+	}
+
 	for _, col := range h.Columns {
-		if strings.Contains(col.Display, "%") {
+		if def := h.Config.Columns[col.Field]; strings.Contains(col.Display, "%") && def.Expr == "" && def.Path == "" {
 			continue
 		}
-		colsDecl = append(colsDecl, ColDecl{Name: "src." + col.Field, Alias: col.Field})
-		if len(col.LOV) > 0 {
+		expr := h.projectedExpr(p.access, col.Field)
+		if expr == "" {
+			continue // not for the request's roles
+		}
+		colsDecl = append(colsDecl, ColDecl{Name: expr, Alias: col.Field})
+		if len(col.LOV) > 0 && !p.access.restricted(col.Field) {
 			entries := []LOVEntry{}
 			for _, item := range col.LOV {
 				lbl := item.Labels[h.Lang]
@@ -59,6 +84,7 @@ func (h *Handler) BuildGridSQL(p RequestParams) (string, string, error) {
 			isNum := strings.ToLower(col.Type) == "integer" || strings.ToLower(col.Type) == "numeric" || strings.ToLower(col.Type) == "double"
 			lovsDecl = append(lovsDecl, LOVDecl{
 				Column:     col.Field,
+				Source:     h.columnExpr(col.Field),
 				Values:     entries,
 				ValuesJSON: string(valJSON),
 				IsBoolean:  isBool,
@@ -71,81 +97,117 @@ func (h *Handler) BuildGridSQL(p RequestParams) (string, string, error) {
 		}
 	}
 
-	type FilterWrap struct {
-		Column    string
-		IsArray   bool
-		IsBoolean bool
-		IsNumber  bool
-		Values    []string
-		Value     string
+	// Row version, sent back by inline cell edits to detect concurrent changes
+	if v := h.versionExpr(true); v != "" && (p.version || h.inlineEdit()) && !p.export {
+		colsDecl = append(colsDecl, ColDecl{Name: v, Alias: "_version"})
 	}
-	filtersWrap := []FilterWrap{}
-	for k, v := range p.Filters {
-		if _, ok := h.Config.Filters[k]; !ok {
-			continue
-		}
 
-		f := FilterWrap{Column: k}
-		if conf, ok := h.Config.Filters[k]; ok {
-			switch conf.Type {
-			case "boolean":
-				f.IsBoolean = true
-			case "integer", "numeric", "double":
-				f.IsNumber = true
-			}
+	// Filters, search and smart filter, bound through the "args" array of the JSON config
+	pred, err := h.compileWhere(p, configArgs, h.fromClause())
+	if err != nil {
+		return "", "", pred, err
+	}
+	config["lovs"] = lovsDecl
+
+	if fts := pred.fts; fts != nil && !p.export {
+		for _, hl := range fts.headlines {
+			colsDecl = append(colsDecl, ColDecl{Name: hl.SQL, Alias: hl.Field + "_headline"})
 		}
-		if len(v) > 1 {
-			f.IsArray = true
-			f.Values = v
-		} else if len(v) == 1 {
-			f.Value = v[0]
+		// Best matches first, unless the user sorts or the grid pages by key
+		if h.Config.Searchable.Rank && len(p.Sort) == 0 && p.keyset == nil {
+			order = "ORDER BY " + fts.rank + " DESC, " + strings.TrimPrefix(order, "ORDER BY ")
+			config["order"] = order
 		}
-		filtersWrap = append(filtersWrap, f)
+	}
+
+	// The keyset seek only narrows the page; the count keeps using pred
+	where, limit, offset := pred.SQL, p.Limit, p.Offset
+	if p.keyset != nil {
+		kb := &whereBuilder{ph: configArgs, args: pred.Args}
+		if where != "" {
+			kb.add(where)
+		}
+		p.keyset.seek(kb)
+		where = strings.Join(kb.clauses, " AND ")
+		config["args"] = kb.args
+		offset = 0
+	} else {
+		config["args"] = pred.Args
+	}
+	if p.probe {
+		limit = p.Limit + 1 // one extra row tells whether another page follows
 	}
 
 	tplData := map[string]interface{}{
 		"TableName": h.TableName,
+		"Joins":     h.joins,
 		"Columns":   colsDecl,
 		"LOVs":      lovsDecl,
-		"Filters":   filtersWrap,
+		"Where":     where,
 		"Order":     order,
-		"Limit":     p.Limit,
-		"Offset":    p.Offset,
+		"Limit":     limit,
+		"Offset":    offset,
 	}
 
 	query, err := h.renderSQL("grid.sql", tplData)
 	if err != nil {
-		return "", "", err
+		return "", "", pred, err
 	}
 	configJSON, _ := json.Marshal(config)
-	return query, string(configJSON), nil
+	return query, string(configJSON), pred, nil
 }
+// FetchData runs FetchDataContext without a request context.
 func (h *Handler) FetchData(p RequestParams) (*TableResult, error) {
-	// Start transaction to use SET LOCAL for threshold
-	tx, err := h.DB.Begin()
+	return h.FetchDataContext(context.Background(), p)
+}
+
+// FetchDataContext loads one page of grid data. Every statement runs in a single
+// transaction bound to ctx, so a closed request cancels it; a statement running past the
+// catalog timeout is returned as *TimeoutError.
+func (h *Handler) FetchDataContext(ctx context.Context, p RequestParams) (*TableResult, error) {
+	if h.IsQueryMode {
+		return h.ExecuteQueryParams(ctx, p)
+	}
+	if err := h.resolveAccess(ctx, &p); err != nil {
+		return nil, err
+	}
+	h.resolveVersion(ctx)
+
+	// Start transaction to use SET LOCAL for threshold and statement timeout
+	tx, err := h.beginQueryTx(ctx)
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
-	if h.Config.Searchable.Operator == "%" && h.Config.Searchable.Threshold > 0 {
-		tx.Exec(fmt.Sprintf("SET LOCAL pg_trgm.similarity_threshold = %f", h.Config.Searchable.Threshold))
-	}
+	h.applySearchSettings(ctx, tx)
 
-	where, args := h.buildWhere(p)
+	// 1. Generate Hybrid SQL
+	p.keyset = h.keyset(p)
+	p.probe = p.Limit > 0 && (p.keyset != nil || h.countMode() == countNone)
+	query, configJSON, pred, err := h.buildGridSQL(p)
+	if err != nil {
+		return nil, err
+	}
 
-	// 0. Get total count
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM %s %s", quote_ident(h.TableName), where)
-	var total int
-	if err := tx.QueryRow(countQuery, args...).Scan(&total); err != nil {
-		if os.Getenv("DEBUG_SQL") == "true" {
-			fmt.Printf("--- COUNT QUERY ERROR ---\nQuery: %s\nError: %v\n------------------------\n", countQuery, err)
-		}
+	// 2. Count (or estimate) with the same WHERE clause and config
+	// The pg_class estimate only holds for the bare table, not for a joined source
+	relation := ""
+	if h.joins == "" {
+		relation = quote_ident(h.TableName)
+	}
+	where := castConfigParam(pred.Where())
+	count, err := h.countRows(ctx, tx, h.fromClause(), where, relation, configArg(where, configJSON)...)
+	if err != nil {
 		return nil, err
 	}
 
-	// 1. Generate Hybrid SQL
-	query, configJSON, err := h.BuildGridSQL(p)
+	// Footer aggregates over the same filtered rows
+	aggregates, err := h.aggregateRow(ctx, tx, p.access, h.fromClause(), where, configArg(where, configJSON)...)
+	if err != nil {
+		return nil, err
+	}
+	facets, err := h.facets(ctx, tx, p)
 	if err != nil {
 		return nil, err
 	}
@@ -154,35 +216,85 @@ func (h *Handler) FetchData(p RequestParams) (*TableResult, error) {
 		fmt.Printf("--- GRID SQL ---\n%s\n----------------\n", query)
 	}
 
-	// 2. Fetch Records using streaming wrapper
-	records := []map[string]interface{}{}
-	rows, err := tx.Query("SELECT datagrid.datagrid_execute_json($1, $2)", query, configJSON)
+	// 3. Fetch Records using streaming wrapper
+	records, err := h.runStatement(ctx, tx, query, configJSON)
+	if err != nil && os.Getenv("DEBUG_SQL") == "true" {
+		fmt.Printf("--- SQL EXEC ERROR ---\nError: %v\n---------------------\n", err)
+	}
 	if err != nil {
-		if os.Getenv("DEBUG_SQL") == "true" {
-			fmt.Printf("--- SQL EXEC ERROR ---\nError: %v\n---------------------\n", err)
-		}
-	} else {
-		defer rows.Close()
-		for rows.Next() {
-			var rowJSON string
-			if err := rows.Scan(&rowJSON); err == nil {
-				var row map[string]interface{}
-				if err := json.Unmarshal([]byte(rowJSON), &row); err == nil {
-					records = append(records, row)
-				}
-			}
+		return nil, fmt.Errorf("failed to execute grid data: %w", h.queryError(ctx, err))
+	}
+
+	var prev, next string
+	more := false
+	if p.keyset != nil {
+		records, prev, next = p.keyset.paginate(records, p.Limit)
+		more = next != ""
+		p.Offset = 0
+	} else if p.probe && len(records) > p.Limit {
+		records, more = records[:p.Limit], true
+	}
+
+	// 4. Post-process records (Styling & Metadata)
+	h.decorateRecords(records)
+
+	res := h.newTableResult(records, count.Total, p)
+	res.CountMode, res.CountMore = count.Mode, count.More
+	res.Aggregates, res.Facets = aggregates, facets
+	if count.Mode == countNone {
+		res.TotalCount, res.CountMore = p.Offset+len(records), more
+	}
+	if p.keyset != nil {
+		res.Keyset, res.PrevCursor, res.NextCursor = true, prev, next
+	}
+	return res, tx.Commit()
+}
+
+// FetchRecordsContext returns every row matching the request's filters and search (no
+// paging). It feeds the in-memory views — Pivot2DataContext and
+// HeatmapDataContext — so they aggregate the same row set the grid and pivot show.
+func (h *Handler) FetchRecordsContext(ctx context.Context, p RequestParams) ([]map[string]interface{}, error) {
+	p.Limit, p.Offset = 0, 0
+	if h.IsQueryMode {
+		res, err := h.ExecuteQueryParams(ctx, p)
+		if err != nil {
+			return nil, err
 		}
+		return res.Records, nil
+	}
+	if err := h.resolveAccess(ctx, &p); err != nil {
+		return nil, err
 	}
 
+	query, configJSON, err := h.BuildGridSQL(p)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute grid data: %w", err)
+		return nil, err
 	}
 
-	// 3. Post-process records (Styling & Metadata)
+	tx, err := h.beginQueryTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	h.applySearchSettings(ctx, tx)
+
+	records, err := h.runStatement(ctx, tx, query, configJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute grid data: %w", h.queryError(ctx, err))
+	}
+	return records, nil
+}
+
+// decorateRecords attaches _json, LOV labels and row styling to fetched records.
+func (h *Handler) decorateRecords(records []map[string]interface{}) {
 	for i, row := range records {
 		if jsonBytes, err := json.Marshal(row); err == nil {
 			row["_json"] = string(jsonBytes)
 		}
+		if key := h.recordKey(row); key != "" {
+			row["_key"] = key
+		}
 
 		var rowStyles []string
 		var rowClasses []string
@@ -221,13 +333,17 @@ func (h *Handler) FetchData(p RequestParams) (*TableResult, error) {
 			row["_row_class"] = strings.Join(rowClasses, " ")
 		}
 	}
+}
 
+// newTableResult wraps decorated records with the handler's rendering metadata.
+func (h *Handler) newTableResult(records []map[string]interface{}, total int, p RequestParams) *TableResult {
+	h.ensureAccess(&p)
 	res := &TableResult{
 		Records:             records,
 		TotalCount:          total,
 		Offset:              p.Offset,
 		Limit:               p.Limit,
-		UIColumns:           h.Columns,
+		UIColumns:           h.visibleColumns(p.access),
 		Config:              h.Config,
 		Lang:                h.Lang,
 		IconStyleLibrary:    h.IconStyleLibrary,
@@ -235,6 +351,15 @@ func (h *Handler) FetchData(p RequestParams) (*TableResult, error) {
 		Title:               h.Catalog.Title,
 		ListEndpoint:        h.ListEndpoint,
 		LOVChooserThreshold: h.LOVChooserThreshold,
+		ColumnSearch:        h.activeColumnSearches(p.ColumnSearch),
+	}
+
+	if h.inlineEdit() {
+		res.CellEndpoint = h.CellEndpoint
+		res.UIColumns = append([]UIColumn(nil), res.UIColumns...)
+		for i, c := range res.UIColumns {
+			res.UIColumns[i].Editable = h.cellEditable(c.Field, p.access)
+		}
 	}
 
 	// Detect if any column is JSON for UI buttons
@@ -244,114 +369,74 @@ func (h *Handler) FetchData(p RequestParams) (*TableResult, error) {
 			break
 		}
 	}
-	return res, tx.Commit()
+	return res
 }
-func (h *Handler) buildWhere(p RequestParams) (string, []interface{}) {
-	clauses := []string{}
-	args := []interface{}{}
-	argIdx := 1
-
-	// Exact Filters (LOVs)
-	for field, values := range p.Filters {
-		// Check if defined in Config Filters
-		filterDef, isDefined := h.Config.Filters[field]
-		if !isDefined {
-			continue // Strict mode: only filters defined in JSON
-		}
-
-		colName := filterDef.Column
-		if colName == "" {
-			colName = field
-		}
-
-		var paramParts []string
-		hasNone := false
-		for _, val := range values {
-			if val == "__NONE__" {
-				hasNone = true
-				continue
-			}
-			if val == "" {
-				continue
-			}
-			paramParts = append(paramParts, fmt.Sprintf("$%d", argIdx))
-
-			// Handle Type Conversion
-			switch filterDef.Type {
-			case "int_bool":
-				if val == "true" {
-					args = append(args, 1)
-				} else {
-					args = append(args, 0)
-				}
-			case "boolean":
-				if val == "true" {
-					args = append(args, true)
-				} else {
-					args = append(args, false)
-				}
-			case "number":
-				var num int
-				fmt.Sscanf(val, "%d", &num)
-				args = append(args, num)
-			default:
-				args = append(args, val)
-			}
-			argIdx++
-		}
-
-		if hasNone && len(paramParts) == 0 {
-			clauses = append(clauses, "1=0")
-		} else if len(paramParts) > 0 {
 
-			finalCol := colName
-			if !strings.Contains(finalCol, "->") && !strings.Contains(finalCol, "(") && !strings.Contains(finalCol, "\"") {
-				finalCol = fmt.Sprintf("\"%s\"", finalCol)
-			}
-			clauses = append(clauses, fmt.Sprintf("%s IN (%s)", finalCol, strings.Join(paramParts, ", ")))
-		}
+// applySearchSettings sets the transaction-local pg_trgm threshold for similarity search.
+func (h *Handler) applySearchSettings(ctx context.Context, tx *sql.Tx) {
+	if h.Config.Searchable.Operator == "%" && h.Config.Searchable.Threshold > 0 {
+		tx.ExecContext(ctx, fmt.Sprintf("SET LOCAL pg_trgm.similarity_threshold = %f", h.Config.Searchable.Threshold))
 	}
+}
 
-	// Search
-	if p.Search != "" {
-		searchCols := []string{}
-		if len(h.Config.Searchable.Columns) > 0 {
-			for _, sc := range h.Config.Searchable.Columns {
-				searchCols = append(searchCols, fmt.Sprintf("(%s)::text", sc))
-			}
-		} else {
-			// Fallback: search in all text/unknown columns
-			for _, c := range h.Columns {
-				if c.Type == "" || c.Type == "text" || c.Type == "varchar" || c.Type == "string" {
-					searchCols = append(searchCols, fmt.Sprintf("%s::text", c.Field))
-				}
-			}
-		}
+// orderColumn is one validated ORDER BY term.
+type orderColumn struct {
+	Field string // Column name, "" for JSON paths
+	Expr  string // SQL expression as rendered in ORDER BY
+	Dir   string // ASC, DESC, optionally with NULLS FIRST/LAST
+}
 
-		if len(searchCols) > 0 {
-			op := h.Config.Searchable.Operator
-			if op == "" {
-				op = "%" // Default to similarity
-			}
+func (h *Handler) buildOrder(sorts []string) string {
+	cols := h.orderColumns(sorts)
+	clauses := make([]string, len(cols))
+	for i, c := range cols {
+		clauses[i] = fmt.Sprintf("%s %s", c.Expr, c.Dir)
+	}
+	return "ORDER BY " + strings.Join(clauses, ", ")
+}
 
-			orClauses := []string{}
-			for _, col := range searchCols {
-				orClauses = append(orClauses, fmt.Sprintf("%s %s $%d::text", col, op, argIdx))
-			}
-			clauses = append(clauses, "("+strings.Join(orClauses, " OR ")+")")
+// dynPrefix marks a sort on a key of a JSON column (dyn-<column>.<key>[.<key>...]), as
+// added by the "expand JSON keys" button.
+const dynPrefix = "dyn-"
 
-			args = append(args, p.Search)
-			argIdx++
+// dynPath splits a dyn- field into its JSON column and keys; ok is false unless the
+// column is a known one and there is at least one key.
+func (h *Handler) dynPath(field string) (column string, keys []string, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(field, dynPrefix), ".")
+	if len(parts) < 2 {
+		return "", nil, false
+	}
+	if _, known := h.uiColumn(parts[0]); !known {
+		return "", nil, false
+	}
+	for _, k := range parts[1:] {
+		if k == "" {
+			return "", nil, false
 		}
 	}
+	return parts[0], parts[1:], true
+}
 
-	if len(clauses) == 0 {
-		return "", args
+// dynSortExpr renders a dyn- sort as a JSON extraction with quoted keys.
+func (h *Handler) dynSortExpr(field string) (string, bool) {
+	column, keys, ok := h.dynPath(field)
+	if !ok {
+		return "", false
 	}
-
-	return "WHERE " + strings.Join(clauses, " AND "), args
+	expr := h.columnExpr(column)
+	for i, k := range keys {
+		op := "->"
+		if i == len(keys)-1 {
+			op = "->>"
+		}
+		expr += fmt.Sprintf("%s'%s'", op, sanitizeParam(k))
+	}
+	return expr, true
 }
-func (h *Handler) buildOrder(sorts []string) string {
+
+// orderColumns resolves the requested sorts against the known columns, falling back to
+// the catalog default sort (or the id / primary key column, descending).
+func (h *Handler) orderColumns(sorts []string) []orderColumn {
 	validateDir := func(d string) string {
 		d = strings.ToUpper(d)
 		valid := []string{"ASC", "DESC", "ASC NULLS FIRST", "ASC NULLS LAST", "DESC NULLS FIRST", "DESC NULLS LAST"}
@@ -384,10 +469,10 @@ func (h *Handler) buildOrder(sorts []string) string {
 		}
 	}
 
-	defaultSort := fmt.Sprintf("ORDER BY %s DESC", defaultSortCol)
+	defaultSort := []orderColumn{{Field: defaultSortCol, Expr: defaultSortCol, Dir: "DESC"}}
 	if h.Config.Defaults.SortColumn != "" {
 		dir := validateDir(h.Config.Defaults.SortDirection)
-		defaultSort = fmt.Sprintf("ORDER BY %s %s", h.Config.Defaults.SortColumn, dir)
+		defaultSort = []orderColumn{{Field: h.Config.Defaults.SortColumn, Expr: h.Config.Defaults.SortColumn, Dir: dir}}
 	}
 
 	if len(sorts) == 0 {
@@ -400,7 +485,7 @@ func (h *Handler) buildOrder(sorts []string) string {
 		allSorts = append(allSorts, strings.Split(s, ",")...)
 	}
 
-	clauses := []string{}
+	clauses := []orderColumn{}
 	for _, s := range allSorts {
 		field := s
 		dirStr := "ASC"
@@ -417,20 +502,15 @@ func (h *Handler) buildOrder(sorts []string) string {
 		}
 
 		dbCol := field
-		if strings.HasPrefix(field, "dyn-") {
-			// Extract JSON path: dyn-data.role -> data->>'role'
-			path := strings.TrimPrefix(field, "dyn-")
-			pp := strings.Split(path, ".")
-			if len(pp) > 1 {
-				dbCol = pp[0]
-				for i := 1; i < len(pp); i++ {
-					if i == len(pp)-1 {
-						dbCol += fmt.Sprintf("->>'%s'", pp[i])
-					} else {
-						dbCol += fmt.Sprintf("->'%s'", pp[i])
-					}
-				}
+		colField := field
+		if strings.HasPrefix(field, dynPrefix) {
+			colField = ""
+			// JSON path: dyn-data.role -> src."data"->>'role'
+			expr, ok := h.dynSortExpr(field)
+			if !ok {
+				continue
 			}
+			dbCol = expr
 		} else {
 			found := false
 			for _, col := range h.Columns {
@@ -448,11 +528,11 @@ func (h *Handler) buildOrder(sorts []string) string {
 		if !strings.Contains(dbCol, "->") && !strings.Contains(dbCol, "(") && !strings.Contains(dbCol, "\"") {
 			dbCol = fmt.Sprintf("\"%s\"", dbCol)
 		}
-		clauses = append(clauses, fmt.Sprintf("%s %s", dbCol, dir))
+		clauses = append(clauses, orderColumn{Field: colField, Expr: dbCol, Dir: dir})
 	}
 
 	if len(clauses) == 0 {
 		return defaultSort
 	}
-	return "ORDER BY " + strings.Join(clauses, ", ")
+	return clauses
 }
@@ -0,0 +1,193 @@
+package datagrid
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	tt "text/template"
+)
+
+// SQLTemplates embeds the default grid and pivot statement templates
+//
+//go:embed internal/sql/templates/*.tmpl
+var SQLTemplates embed.FS
+
+// sqlTemplateNames are the statements renderSQL renders, each read from <name>.tmpl.
+var sqlTemplateNames = []string{"grid.sql", "pivot.sql"}
+
+var sqlFuncs = tt.FuncMap{
+	"add":         func(a, b int) int { return a + b },
+	"quote_ident": quote_ident,
+	"coalesce": func(s ...string) string {
+		for _, v := range s {
+			if v != "" {
+				return v
+			}
+		}
+		return ""
+	},
+}
+
+// sqlTemplateSet holds parsed statement templates by name.
+type sqlTemplateSet map[string]*tt.Template
+
+var (
+	sqlTemplatesMu   sync.RWMutex
+	sqlTemplatesOnce sync.Once
+	sqlTemplatesErr  error
+	sqlTemplates     sqlTemplateSet // Registered set; the embedded defaults until RegisterSQLTemplates
+)
+
+// parseSQLTemplates parses every statement template, taking <name>.tmpl from override
+// when it has one and from the embedded defaults otherwise.
+func parseSQLTemplates(override fs.FS) (sqlTemplateSet, error) {
+	defaults, err := fs.Sub(SQLTemplates, "internal/sql/templates")
+	if err != nil {
+		return nil, err
+	}
+	set := make(sqlTemplateSet, len(sqlTemplateNames))
+	for _, name := range sqlTemplateNames {
+		file := name + ".tmpl"
+		var data []byte
+		err := fs.ErrNotExist
+		if override != nil {
+			data, err = fs.ReadFile(override, file)
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			data, err = fs.ReadFile(defaults, file)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("SQL template %s: %w", file, err)
+		}
+		tmpl, err := tt.New(name).Funcs(sqlFuncs).Parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("SQL template %s: %w", file, err)
+		}
+		set[name] = tmpl
+	}
+	return set, nil
+}
+
+// registeredSQLTemplates returns the registered set, parsing the embedded defaults on
+// first use.
+func registeredSQLTemplates() (sqlTemplateSet, error) {
+	sqlTemplatesOnce.Do(func() {
+		set, err := parseSQLTemplates(nil)
+		sqlTemplatesMu.Lock()
+		defer sqlTemplatesMu.Unlock()
+		if sqlTemplates == nil {
+			sqlTemplates, sqlTemplatesErr = set, err
+		}
+	})
+	sqlTemplatesMu.RLock()
+	defer sqlTemplatesMu.RUnlock()
+	return sqlTemplates, sqlTemplatesErr
+}
+
+// RegisterSQLTemplates layers fsys over the embedded statement templates: a grid.sql.tmpl
+// or pivot.sql.tmpl at its root replaces the default, missing files keep it. The set is
+// parsed and checked against a sample catalog (see CheckSQLTemplates) before it replaces
+// the registered one, so a broken override fails at startup instead of on a request.
+func RegisterSQLTemplates(fsys fs.FS) error {
+	set, err := parseSQLTemplates(fsys)
+	if err != nil {
+		return err
+	}
+	if err := checkSQLTemplates(set); err != nil {
+		return err
+	}
+	sqlTemplatesOnce.Do(func() {}) // the defaults are no longer needed
+	sqlTemplatesMu.Lock()
+	defer sqlTemplatesMu.Unlock()
+	sqlTemplates, sqlTemplatesErr = set, nil
+	return nil
+}
+
+// CheckSQLTemplates renders every registered statement template against a sample
+// catalog (lookup join, LOV filter, search, pivot). Hosts call it at startup.
+func CheckSQLTemplates() error {
+	set, err := registeredSQLTemplates()
+	if err != nil {
+		return err
+	}
+	return checkSQLTemplates(set)
+}
+
+// sampleCatalog exercises the template inputs: a joined lookup column, an LOV column
+// (LOV lateral joins), a filter, search and a pivot with LOV dimensions.
+const sampleCatalog = `{
+	"objects": [
+		{"name": "sample_orders", "columns": [
+			{"name": "id", "type": "integer", "primary_key": true},
+			{"name": "customer_id", "type": "integer"},
+			{"name": "status", "type": "text"},
+			{"name": "amount", "type": "numeric"},
+			{"name": "customer_name", "type": "text", "from": "sample_customers.name"}
+		]},
+		{"name": "sample_customers", "join": {"on": {"customer_id": "id"}}, "columns": [
+			{"name": "id", "type": "integer"},
+			{"name": "name", "type": "text"}
+		]}
+	],
+	"datagrid": {
+		"columns": {
+			"status": {"lov": [{"value": "open", "label": "Open"}, {"value": "closed", "label": "Closed"}]}
+		},
+		"filters": {"status": {"column": "status", "type": "text"}},
+		"searchable": {"columns": ["customer_name", "status"]},
+		"pivot": {
+			"rows": [{"column": "status"}],
+			"columns": [{"column": "customer_name"}],
+			"values": [{"column": "amount", "func": "SUM"}, {"column": "id", "func": "COUNT"}]
+		}
+	}
+}`
+
+// checkSQLTemplates renders the grid (plain, filtered and sorted) and pivot statements of
+// the sample catalog with set.
+func checkSQLTemplates(set sqlTemplateSet) error {
+	h, err := NewHandlerFromDataContext(context.Background(), nil, []byte(sampleCatalog), "en")
+	if err != nil {
+		return fmt.Errorf("SQL template check: sample catalog: %w", err)
+	}
+	h.sqlTemplates = set
+
+	requests := []RequestParams{
+		{Limit: 10},
+		{Limit: 10, Search: "sample", Sort: []string{"amount:DESC"}, Filters: map[string][]string{"status": {"open"}}},
+	}
+	for _, p := range requests {
+		query, _, err := h.BuildGridSQL(p)
+		if err == nil && !strings.Contains(query, "SELECT") {
+			err = errors.New("rendered statement has no SELECT")
+		}
+		if err != nil {
+			return fmt.Errorf("SQL template check: grid.sql: %w", err)
+		}
+	}
+	query, _, _, err := h.buildPivotSQL(RequestParams{Filters: map[string][]string{"status": {"open"}}})
+	if err == nil && !strings.Contains(query, "GROUP BY") {
+		err = errors.New("rendered statement has no GROUP BY")
+	}
+	if err != nil {
+		return fmt.Errorf("SQL template check: pivot.sql: %w", err)
+	}
+	return nil
+}
+
+// render executes the named template; see Handler.renderSQL.
+func (set sqlTemplateSet) render(name string, data interface{}) (string, error) {
+	tmpl, ok := set[name]
+	if !ok {
+		return "", fmt.Errorf("unknown SQL template %q", name)
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
@@ -5,9 +5,7 @@ import (
 	"fmt"
 	"html/template"
 	"log/slog"
-	"os"
 	"strings"
-	tt "text/template"
 )
 
 // TemplateFuncs returns a map of standard datagrid template functions
@@ -45,6 +43,32 @@ func TemplateFuncs() template.FuncMap {
 		"inputType":    func(p QueryParam) string { return p.InputType() },
 		"constantKey":  func(p QueryParam) string { return p.ConstantKey() },
 		"displayLabel": func(p QueryParam) string { return p.DisplayLabel() },
+		"paramError":   paramErrorFor,
+
+		// dependent LOVs: hx-trigger list and selection kept across refreshes
+		"optionsTrigger": optionsTrigger,
+		"dateRange":      dateRangeControl,
+		"countLabel":     countLabel,
+		"highlight":      highlight,
+
+		// footer aggregates (TableResult.Aggregates)
+		"formatAggregate": formatAggregate,
+
+		// datagrid_rows: the result narrowed to one record, for datagrid_cells
+		"withRow": func(res *TableResult, row map[string]interface{}) *TableResult {
+			r := *res
+			r.Records = []map[string]interface{}{row}
+			return &r
+		},
+		"isSelected": func(selected []string, val interface{}) bool {
+			s := fmt.Sprintf("%v", val)
+			for _, v := range selected {
+				if v == s {
+					return true
+				}
+			}
+			return false
+		},
 
 		// lov-tree: indent label by depth
 		"indentLabel": func(item LOVItem) string {
@@ -103,41 +127,22 @@ func quote_ident(s string) string {
 	}
 	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
 }
-// renderSQL renders a Go text/template for SQL generation
+// renderSQL renders a statement template (see RegisterSQLTemplates) for SQL generation
 func (h *Handler) renderSQL(tmplName string, data interface{}) (string, error) {
-	// For simplicity in this demo, we'll read from disk.
-	tmplPath := fmt.Sprintf("internal/sql/templates/%s.tmpl", tmplName)
-	content, err := os.ReadFile(tmplPath)
-	if err != nil {
-		return "", err
-	}
-
-	funcMap := template.FuncMap{
-		"add":         func(a, b int) int { return a + b },
-		"quote_ident": quote_ident,
-		"coalesce": func(s ...string) string {
-			for _, v := range s {
-				if v != "" {
-					return v
-				}
-			}
-			return ""
-		},
+	set := h.sqlTemplates
+	if set == nil {
+		var err error
+		if set, err = registeredSQLTemplates(); err != nil {
+			return "", err
+		}
 	}
-
-	tmpl, err := tt.New(tmplName).Funcs(funcMap).Parse(string(content))
+	sql, err := set.render(tmplName, data)
 	if err != nil {
 		return "", err
 	}
 
-	var sb strings.Builder
-	if err := tmpl.Execute(&sb, data); err != nil {
-		return "", err
-	}
-
-	result := sb.String()
 	// Automatically cast $1 to jsonb for Postgres type inference
-	result = strings.ReplaceAll(result, "$1", "$1::jsonb")
+	result := castConfigParam(sql)
 
 	slog.Debug("Rendered SQL template", "template", tmplName, "sql", result)
 	return result, nil
@@ -0,0 +1,283 @@
+package datagrid
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamRule is a cross-field check between two query parameters,
+// e.g. {"field": "date_to", "op": ">=", "other": "date_from"}.
+type ParamRule struct {
+	Field   string `json:"field"`
+	Op      string `json:"op"` // =, !=, <, <=, >, >=
+	Other   string `json:"other"`
+	Message string `json:"message,omitempty"`
+}
+
+// ParamError is a single failed parameter check.
+type ParamError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned before any SQL runs when submitted parameter values
+// fail the checks declared in the catalog.
+type ValidationError struct {
+	Errors []ParamError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return "invalid parameters: " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) add(field, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, ParamError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// paramErrorFor returns the first message for field, or "".
+func paramErrorFor(errs []ParamError, field string) string {
+	for _, fe := range errs {
+		if fe.Field == field {
+			return fe.Message
+		}
+	}
+	return ""
+}
+
+// patternRegexp returns the compiled Pattern, or nil when there is none. Catalog
+// parameters are compiled when the handler is built; only parameters the host set on
+// Handler.QueryParams itself are compiled here.
+func (p QueryParam) patternRegexp() (*regexp.Regexp, error) {
+	if p.pattern != nil || p.Pattern == "" {
+		return p.pattern, nil
+	}
+	return regexp.Compile(p.Pattern)
+}
+
+// ValidateParams checks values against the required, min, max, pattern and max_items
+// declarations of every parameter and the catalog's cross-field rules.
+// It returns nil or a *ValidationError listing every failed field.
+func (h *Handler) ValidateParams(values map[string][]string) error {
+	verr := &ValidationError{}
+	parsed := make(map[string]string) // field -> first value, for cross-field rules
+
+	for _, p := range h.QueryParams {
+		if p.InputType() == "constant" {
+			continue
+		}
+		if p.InputType() == "daterange" {
+			h.validateDateRange(p, values, verr, parsed)
+			continue
+		}
+		castType := p.sqlCastType()
+		baseType := strings.TrimSuffix(castType, "[]")
+
+		var items []string
+		for _, v := range h.paramValues(p, values) {
+			if p.IsArray {
+				for _, item := range strings.Split(v, ",") {
+					if item = strings.TrimSpace(item); item != "" {
+						items = append(items, item)
+					}
+				}
+			} else if v = strings.TrimSpace(v); v != "" && !strings.EqualFold(v, "NULL") {
+				items = append(items, v)
+				break
+			}
+		}
+
+		if len(items) == 0 {
+			if p.Required {
+				verr.add(p.Name, "%s is required", p.DisplayLabel())
+			}
+			continue
+		}
+		if p.MaxItems > 0 && len(items) > p.MaxItems {
+			verr.add(p.Name, "select at most %d items", p.MaxItems)
+			continue
+		}
+
+		for _, item := range items {
+			if _, err := convertParamValue(baseType, item); err != nil {
+				verr.add(p.Name, "%s", err.Error())
+				break
+			}
+			if msg := p.checkBounds(baseType, item); msg != "" {
+				verr.add(p.Name, "%s", msg)
+				break
+			}
+			re, err := p.patternRegexp()
+			if err != nil {
+				verr.add(p.Name, "invalid pattern in catalog: %v", err)
+				break
+			}
+			if re != nil && !re.MatchString(item) {
+				verr.add(p.Name, "%q does not match the expected format", item)
+				break
+			}
+		}
+		parsed[p.Name] = items[0]
+	}
+
+	for _, rule := range h.Catalog.Rules {
+		a, okA := parsed[rule.Field]
+		b, okB := parsed[rule.Other]
+		if !okA || !okB || paramErrorFor(verr.Errors, rule.Field) != "" || paramErrorFor(verr.Errors, rule.Other) != "" {
+			continue // optional side left empty, or already reported
+		}
+		baseType := "text"
+		for _, p := range h.QueryParams {
+			if p.Name == rule.Field {
+				baseType = strings.TrimSuffix(p.sqlCastType(), "[]")
+				break
+			}
+		}
+		cmp, err := compareParamValues(baseType, a, b)
+		if err != nil {
+			verr.add(rule.Field, "%s", err.Error())
+			continue
+		}
+		if !ruleHolds(rule.Op, cmp) {
+			if rule.Message != "" {
+				verr.add(rule.Field, "%s", rule.Message)
+			} else {
+				verr.add(rule.Field, "must be %s %s", rule.Op, h.paramLabel(rule.Other))
+			}
+		}
+	}
+
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// validateDateRange checks a daterange parameter: known preset, valid dates, start not
+// after end, and Min/Max on both ends. The bounds are exposed to cross-field rules as
+// <name>_from and <name>_to.
+func (h *Handler) validateDateRange(p QueryParam, values map[string][]string, verr *ValidationError, parsed map[string]string) {
+	from, to, err := p.resolveRange(values, time.Now())
+	if err != nil {
+		verr.add(p.Name, "%s", err.Error())
+		return
+	}
+	if from == "" && to == "" {
+		if p.Required {
+			verr.add(p.Name, "%s is required", p.DisplayLabel())
+		}
+		return
+	}
+	if from != "" && to != "" && from > to {
+		verr.add(p.Name, "start date must not be after end date")
+		return
+	}
+	for _, d := range []string{from, to} {
+		if d == "" {
+			continue
+		}
+		if msg := p.checkBounds("date", d); msg != "" {
+			verr.add(p.Name, "%s", msg)
+			return
+		}
+	}
+	if from != "" {
+		parsed[p.Name+"_from"] = from
+	}
+	if to != "" {
+		parsed[p.Name+"_to"] = to
+	}
+}
+
+// checkBounds applies Min/Max to a single (already type-checked) value.
+func (p QueryParam) checkBounds(baseType, val string) string {
+	if p.Min != "" {
+		if cmp, err := compareParamValues(baseType, val, boundValue(baseType, p.Min)); err == nil && cmp < 0 {
+			return fmt.Sprintf("must be at least %s", p.Min)
+		}
+	}
+	if p.Max != "" {
+		if cmp, err := compareParamValues(baseType, val, boundValue(baseType, p.Max)); err == nil && cmp > 0 {
+			return fmt.Sprintf("must be at most %s", p.Max)
+		}
+	}
+	return ""
+}
+
+// boundValue resolves date expressions (CURRENT_DATE, "CURRENT_DATE - 30", start_of_month) in date bounds.
+func boundValue(baseType, bound string) string {
+	if baseType == "date" {
+		if d, ok := resolveDateExpr(bound, time.Now()); ok {
+			return d.Format(dateLayout)
+		}
+	}
+	return bound
+}
+
+// compareParamValues compares a and b as the given SQL type (-1, 0, 1).
+// Numbers compare numerically, dates chronologically, anything else lexically.
+func compareParamValues(baseType, a, b string) (int, error) {
+	switch {
+	case baseType == "date":
+		ta, err := time.Parse("2006-01-02", a)
+		if err != nil {
+			return 0, fmt.Errorf("invalid date %q", a)
+		}
+		tb, err := time.Parse("2006-01-02", b)
+		if err != nil {
+			return 0, fmt.Errorf("invalid date %q", b)
+		}
+		return ta.Compare(tb), nil
+	case isNumericType(baseType) && baseType != "interval":
+		fa, err := strconv.ParseFloat(a, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", a)
+		}
+		fb, err := strconv.ParseFloat(b, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", b)
+		}
+		switch {
+		case fa < fb:
+			return -1, nil
+		case fa > fb:
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return strings.Compare(a, b), nil
+	}
+}
+
+func ruleHolds(op string, cmp int) bool {
+	switch strings.TrimSpace(op) {
+	case "=", "==":
+		return cmp == 0
+	case "!=", "<>":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return true
+}
+
+func (h *Handler) paramLabel(name string) string {
+	for _, p := range h.QueryParams {
+		if p.Name == name {
+			return p.DisplayLabel()
+		}
+	}
+	return name
+}
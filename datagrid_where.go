@@ -0,0 +1,413 @@
+package datagrid
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// placeholder renders the reference to the i-th bound argument of a compiled predicate,
+// cast to the given SQL type.
+type placeholder func(i int, cast string) string
+
+// positionalArgs numbers the arguments $start, $start+1, ... for statements executed
+// directly (COUNT(*), query mode).
+func positionalArgs(start int) placeholder {
+	return func(i int, cast string) string {
+		return fmt.Sprintf("$%d::%s", start+i, cast)
+	}
+}
+
+// configArgs reads the arguments from the "args" array of the JSON config that
+// datagrid_execute_json / datagrid_execute_csv pass to the statement as $1.
+func configArgs(i int, cast string) string {
+	return fmt.Sprintf("($1 #>> '{args,%d}')::%s", i, cast)
+}
+
+// Predicate is the compiled WHERE clause of a request: one SQL fragment (without the
+// WHERE keyword) and its bound arguments. Count, grid, pivot and export all use it, so
+// every view of a catalog shows the same row set.
+type Predicate struct {
+	SQL    string
+	Having string // Smart-filter conditions on pivot measures, without the HAVING keyword
+	Args   []interface{}
+
+	fts *ftsMatch // Full-text search rank and snippets, when searchable.operator is "fts"
+}
+
+// Where returns the fragment prefixed with WHERE, or "" when nothing is filtered.
+func (pr Predicate) Where() string {
+	if pr.SQL == "" {
+		return ""
+	}
+	return "WHERE " + pr.SQL
+}
+
+// whereBuilder collects AND-ed clauses and their arguments.
+type whereBuilder struct {
+	ph      placeholder
+	source  string // FROM item of the filtered statement, aliased src
+	clauses []string
+	having  []string
+	args    []interface{}
+	fts     *ftsMatch
+	access  columnAccess // Restricted columns, which neither search nor the smart filter may use
+}
+
+// bind adds an argument and returns its placeholder.
+func (b *whereBuilder) bind(v interface{}, cast string) string {
+	ref := b.ph(len(b.args), cast)
+	b.args = append(b.args, v)
+	return ref
+}
+
+func (b *whereBuilder) add(clause string) {
+	b.clauses = append(b.clauses, clause)
+}
+
+func (b *whereBuilder) predicate() Predicate {
+	return Predicate{SQL: strings.Join(b.clauses, " AND "), Having: strings.Join(b.having, " AND "), Args: b.args, fts: b.fts}
+}
+
+// compileWhere compiles the request's catalog filters, searches and smart filter into a
+// Predicate whose argument references are rendered by ph. source is the FROM item the
+// statement filters (aliased src, with its joins), needed by pivot2 measure conditions.
+func (h *Handler) compileWhere(p RequestParams, ph placeholder, source string) (Predicate, error) {
+	h.ensureAccess(&p)
+	b := &whereBuilder{ph: ph, source: source, access: p.access}
+	h.compileRowKey(b, p.rowKey)
+	h.compileFilters(b, p.Filters)
+	h.compileSearch(b, p.Search)
+	h.compileColumnSearch(b, p.ColumnSearch)
+	if err := h.compileSmartFilter(b, p.Query, p.measures); err != nil {
+		return Predicate{}, err
+	}
+	return b.predicate(), nil
+}
+
+// Filter operators, submitted as <field>__<op>=value (e.g. salary__gte=5000,
+// hired__between=2024-01-01,2024-12-31). A bare <field>=value means "in".
+const (
+	opIn         = "in"
+	opNotIn      = "not_in"
+	opGt         = "gt"
+	opGte        = "gte"
+	opLt         = "lt"
+	opLte        = "lte"
+	opBetween    = "between"
+	opContains   = "contains"
+	opStartsWith = "starts_with"
+	opIsNull     = "is_null"
+	opIsNotNull  = "is_not_null"
+	opDateRange  = "date_range"
+)
+
+var filterOperators = map[string]bool{
+	opIn: true, opNotIn: true, opGt: true, opGte: true, opLt: true, opLte: true, opBetween: true,
+	opContains: true, opStartsWith: true, opIsNull: true, opIsNotNull: true, opDateRange: true,
+}
+
+// allows reports whether the filter accepts op. "in" (exact / LOV match) is always
+// allowed; every other operator must be listed in Operators.
+func (fd FilterDef) allows(op string) bool {
+	if op == opIn {
+		return true
+	}
+	for _, o := range fd.Operators {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// isDate reports whether the filter compares dates (inclusive upper bounds then cover the
+// whole day, also for timestamp columns).
+func (fd FilterDef) isDate() bool {
+	return fd.Type == "date"
+}
+
+// rangeInput returns the HTML input type of the from/to filter rendered for a column, or
+// "" when the filter does not allow both gte and lte.
+func rangeInput(fd FilterDef) string {
+	if !fd.allows(opGte) || !fd.allows(opLte) {
+		return ""
+	}
+	switch fd.Type {
+	case "date":
+		return "date"
+	case "number", "integer", "numeric", "double":
+		return "number"
+	}
+	return ""
+}
+
+// lookupFilter splits a request key into its catalog filter and operator. A filter whose
+// name itself contains "__" wins over the operator syntax.
+func (h *Handler) lookupFilter(key string) (FilterDef, string, bool) {
+	if fd, ok := h.Config.Filters[key]; ok {
+		return fd, opIn, true
+	}
+	i := strings.LastIndex(key, "__")
+	if i <= 0 {
+		return FilterDef{}, "", false
+	}
+	field, op := key[:i], key[i+2:]
+	fd, ok := h.Config.Filters[field]
+	if !ok || !filterOperators[op] || !fd.allows(op) {
+		return FilterDef{}, "", false
+	}
+	if fd.Column == "" {
+		fd.Column = field
+	}
+	return fd, op, true
+}
+
+// compileFilters adds one clause per catalog-defined filter and operator. Keys are
+// visited in name order so the SQL text is stable across requests.
+func (h *Handler) compileFilters(b *whereBuilder, filters map[string][]string) {
+	keys := make([]string, 0, len(filters))
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		filterDef, op, isDefined := h.lookupFilter(key)
+		if !isDefined {
+			continue // Strict mode: only filters (and operators) defined in JSON
+		}
+
+		colName := filterDef.Column
+		if colName == "" {
+			colName = key
+		}
+		col := h.columnExpr(colName)
+
+		switch op {
+		case opIn, opNotIn:
+			compileInFilter(b, filterDef, col, op, filters[key])
+		case opIsNull, opIsNotNull:
+			v := strings.ToLower(firstValue(filters[key]))
+			isNull := op == opIsNull
+			if v == "false" || v == "0" {
+				isNull = !isNull
+			}
+			if isNull {
+				b.add(col + " IS NULL")
+			} else {
+				b.add(col + " IS NOT NULL")
+			}
+		case opContains, opStartsWith:
+			v := firstValue(filters[key])
+			if v == "" {
+				continue
+			}
+			pattern := likeEscaper.Replace(v) + "%"
+			if op == opContains {
+				pattern = "%" + pattern
+			}
+			b.add(fmt.Sprintf("(%s)::text ILIKE %s", col, b.bind(pattern, "text")))
+		case opGt, opGte, opLt, opLte:
+			v := firstValue(filters[key])
+			if v == "" {
+				continue
+			}
+			if !compileBound(b, filterDef, col, op, v) {
+				b.add("1=0")
+			}
+		case opBetween, opDateRange:
+			if op == opDateRange {
+				filterDef.Type = "date"
+			}
+			lo, hi, ok := rangeValues(filterDef, op, filters[key])
+			if !ok {
+				b.add("1=0")
+				continue
+			}
+			if lo != "" && !compileBound(b, filterDef, col, opGte, lo) {
+				b.add("1=0")
+			}
+			if hi != "" && !compileBound(b, filterDef, col, opLte, hi) {
+				b.add("1=0")
+			}
+		}
+	}
+}
+
+// compileInFilter adds col IN (...) or, for not_in, excludes the values while keeping NULLs.
+func compileInFilter(b *whereBuilder, fd FilterDef, col, op string, vals []string) {
+	var refs []string
+	hasNone := false
+	for _, val := range vals {
+		if val == "__NONE__" {
+			hasNone = true
+			continue
+		}
+		if val == "" {
+			continue
+		}
+		arg, cast, ok := filterArg(fd.Type, val)
+		if !ok {
+			hasNone = true // unparsable value matches nothing
+			continue
+		}
+		refs = append(refs, b.bind(arg, cast))
+	}
+
+	if op == opNotIn {
+		if len(refs) > 0 {
+			b.add(fmt.Sprintf("(%s NOT IN (%s) OR %s IS NULL)", col, strings.Join(refs, ", "), col))
+		}
+		return
+	}
+	if hasNone && len(refs) == 0 {
+		b.add("1=0")
+	} else if len(refs) > 0 {
+		b.add(fmt.Sprintf("%s IN (%s)", col, strings.Join(refs, ", ")))
+	}
+}
+
+// compileBound adds a single comparison. Upper bounds of date filters are exclusive of the
+// next day, so lte 2024-12-31 also matches timestamps during that day.
+func compileBound(b *whereBuilder, fd FilterDef, col, op, val string) bool {
+	arg, cast, ok := filterArg(fd.Type, val)
+	if !ok {
+		return false
+	}
+	ref := b.bind(arg, cast)
+	switch {
+	case fd.isDate() && op == opLte:
+		b.add(fmt.Sprintf("%s < %s + 1", col, ref))
+	case fd.isDate() && op == opGt:
+		b.add(fmt.Sprintf("%s >= %s + 1", col, ref))
+	default:
+		sqlOps := map[string]string{opGt: ">", opGte: ">=", opLt: "<", opLte: "<="}
+		b.add(fmt.Sprintf("%s %s %s", col, sqlOps[op], ref))
+	}
+	return true
+}
+
+// rangeValues returns the inclusive bounds of a between / date_range filter, submitted as
+// "lo,hi" or as two values; either end may be empty. A single value is the lower bound
+// only. date_range also accepts a preset key such as "this_month" or "ytd".
+func rangeValues(fd FilterDef, op string, vals []string) (lo, hi string, ok bool) {
+	var parts []string
+	for _, v := range vals {
+		parts = append(parts, strings.Split(v, ",")...)
+	}
+	switch len(parts) {
+	case 0:
+		return "", "", true
+	case 1:
+		lo = strings.TrimSpace(parts[0])
+		if op == opDateRange && lo != "" {
+			if from, to, found := resolveDatePreset(lo, time.Now()); found {
+				return from.Format(dateLayout), to.Format(dateLayout), true
+			}
+		}
+		return lo, "", true
+	case 2:
+		return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), true
+	}
+	return "", "", false
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// filterArg converts a submitted filter value according to the FilterDef type.
+func filterArg(filterType, val string) (interface{}, string, bool) {
+	switch filterType {
+	case "int_bool":
+		if val == "true" || val == "1" {
+			return 1, "integer", true
+		}
+		return 0, "integer", true
+	case "boolean":
+		return val == "true" || val == "1", "boolean", true
+	case "number", "integer", "numeric", "double":
+		if _, err := strconv.ParseFloat(val, 64); err != nil {
+			return nil, "", false
+		}
+		return json.Number(val), "numeric", true
+	case "date":
+		d, ok := resolveDateExpr(val, time.Now())
+		if !ok {
+			return nil, "", false
+		}
+		return d.Format(dateLayout), "date", true
+	default:
+		return val, "text", true
+	}
+}
+
+// filterColumn qualifies and quotes a plain column name with the src alias every
+// statement uses; JSON paths and expressions are used as is.
+func filterColumn(col string) string {
+	if !strings.Contains(col, "->") && !strings.Contains(col, "(") && !strings.Contains(col, "\"") {
+		return fmt.Sprintf("src.\"%s\"", col)
+	}
+	return col
+}
+
+// compileSearch adds the global search: the configured operator (pg_trgm similarity by
+// default) OR-ed across the searchable columns.
+func (h *Handler) compileSearch(b *whereBuilder, search string) {
+	if search == "" {
+		return
+	}
+	if h.ftsEnabled() {
+		h.compileFTS(b, search)
+		return
+	}
+
+	searchCols := []string{}
+	if len(h.Config.Searchable.Columns) > 0 {
+		for _, sc := range h.Config.Searchable.Columns {
+			if h.restrictedField(b.access, sc) {
+				continue
+			}
+			if _, known := h.columnExprs[sc]; known {
+				sc = h.columnExpr(sc)
+			}
+			searchCols = append(searchCols, fmt.Sprintf("(%s)::text", sc))
+		}
+	} else {
+		// Fallback: search in all text/unknown columns
+		for _, c := range h.Columns {
+			if h.restrictedField(b.access, c.Field) {
+				continue
+			}
+			if c.Type == "" || c.Type == "text" || c.Type == "varchar" || c.Type == "string" {
+				searchCols = append(searchCols, fmt.Sprintf("%s::text", h.columnExpr(c.Field)))
+			}
+		}
+	}
+	if len(searchCols) == 0 {
+		return
+	}
+
+	op := h.Config.Searchable.Operator
+	if op == "" {
+		op = "%" // Default to similarity
+	}
+
+	ref := b.bind(search, "text")
+	orClauses := []string{}
+	for _, col := range searchCols {
+		orClauses = append(orClauses, fmt.Sprintf("%s %s %s", col, op, ref))
+	}
+	b.add("(" + strings.Join(orClauses, " OR ") + ")")
+}
+
+var configParamPattern = regexp.MustCompile(`\$1\b`)
+
+// castConfigParam casts every $1 (but not $10, $11, ...) to jsonb, so Postgres can
+// infer the type of the JSON config parameter.
+func castConfigParam(query string) string {
+	return configParamPattern.ReplaceAllString(query, "$$1::jsonb")
+}
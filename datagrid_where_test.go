@@ -0,0 +1,99 @@
+package datagrid
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func filterHandler() *Handler {
+	return &Handler{Config: DatagridConfig{Filters: map[string]FilterDef{
+		"status": {Type: "text", Operators: []string{opNotIn, opContains, opStartsWith, opIsNull, opIsNotNull}},
+		"salary": {Column: "salary", Type: "number", Operators: []string{opGt, opGte, opLt, opLte, opBetween}},
+		"hired":  {Column: "created_at", Type: "date", Operators: []string{opGt, opLte, opBetween, opDateRange}},
+	}}}
+}
+
+func TestCompileFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters map[string][]string
+		sql     string
+		args    []interface{}
+	}{
+		{"in", map[string][]string{"status": {"A", "I"}}, `src."status" IN ($1::text, $2::text)`, []interface{}{"A", "I"}},
+		{"in none", map[string][]string{"status": {"__NONE__"}}, "1=0", nil},
+		{"in empty", map[string][]string{"status": {""}}, "", nil},
+		{"not in", map[string][]string{"status__not_in": {"X"}}, `(src."status" NOT IN ($1::text) OR src."status" IS NULL)`, []interface{}{"X"}},
+		{"is null", map[string][]string{"status__is_null": {"true"}}, `src."status" IS NULL`, nil},
+		{"is null false", map[string][]string{"status__is_null": {"false"}}, `src."status" IS NOT NULL`, nil},
+		{"is not null", map[string][]string{"status__is_not_null": {"1"}}, `src."status" IS NOT NULL`, nil},
+		{"is not null 0", map[string][]string{"status__is_not_null": {"0"}}, `src."status" IS NULL`, nil},
+		{"contains", map[string][]string{"status__contains": {"5%_off"}}, `(src."status")::text ILIKE $1::text`, []interface{}{`%5\%\_off%`}},
+		{"starts with", map[string][]string{"status__starts_with": {"Ac"}}, `(src."status")::text ILIKE $1::text`, []interface{}{"Ac%"}},
+		{"gte", map[string][]string{"salary__gte": {"5000"}}, `src."salary" >= $1::numeric`, []interface{}{json.Number("5000")}},
+		{"lt", map[string][]string{"salary__lt": {"1.5"}}, `src."salary" < $1::numeric`, []interface{}{json.Number("1.5")}},
+		{"not a number", map[string][]string{"salary__gte": {"1 OR 1=1"}}, "1=0", nil},
+		{"date lte", map[string][]string{"hired__lte": {"2024-12-31"}}, `src."created_at" < $1::date + 1`, []interface{}{"2024-12-31"}},
+		{"date gt", map[string][]string{"hired__gt": {"2024-12-31"}}, `src."created_at" >= $1::date + 1`, []interface{}{"2024-12-31"}},
+		{"not a date", map[string][]string{"hired__lte": {"2024-02-30"}}, "1=0", nil},
+		{"between", map[string][]string{"salary__between": {"1000,2000"}}, `src."salary" >= $1::numeric AND src."salary" <= $2::numeric`, []interface{}{json.Number("1000"), json.Number("2000")}},
+		{"between two values", map[string][]string{"salary__between": {"1000", "2000"}}, `src."salary" >= $1::numeric AND src."salary" <= $2::numeric`, []interface{}{json.Number("1000"), json.Number("2000")}},
+		{"between lower only", map[string][]string{"salary__between": {"1000"}}, `src."salary" >= $1::numeric`, []interface{}{json.Number("1000")}},
+		{"between upper only", map[string][]string{"salary__between": {",2000"}}, `src."salary" <= $1::numeric`, []interface{}{json.Number("2000")}},
+		{"between three values", map[string][]string{"salary__between": {"1,2,3"}}, "1=0", nil},
+		{"date between", map[string][]string{"hired__between": {"2024-01-01,2024-01-31"}}, `src."created_at" >= $1::date AND src."created_at" < $2::date + 1`, []interface{}{"2024-01-01", "2024-01-31"}},
+		{"date range from", map[string][]string{"hired__date_range": {"2024-01-01"}}, `src."created_at" >= $1::date`, []interface{}{"2024-01-01"}},
+		{"date range unknown preset", map[string][]string{"hired__date_range": {"next_decade"}}, "1=0", nil},
+		{"operator not allowed", map[string][]string{"salary__contains": {"1"}}, "", nil},
+		{"unknown operator", map[string][]string{"salary__regex": {".*"}}, "", nil},
+		{"unknown filter", map[string][]string{"password": {"x"}}, "", nil},
+		{"sorted keys", map[string][]string{"status": {"A"}, "salary__gt": {"1"}}, `src."salary" > $1::numeric AND src."status" IN ($2::text)`, []interface{}{json.Number("1"), "A"}},
+	}
+	h := filterHandler()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pred, err := h.compileWhere(RequestParams{Filters: tt.filters}, positionalArgs(1), "t src")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pred.SQL != tt.sql {
+				t.Errorf("sql = %s, want %s", pred.SQL, tt.sql)
+			}
+			if !reflect.DeepEqual(pred.Args, tt.args) {
+				t.Errorf("args = %#v, want %#v", pred.Args, tt.args)
+			}
+		})
+	}
+}
+
+func TestRangeValues(t *testing.T) {
+	tests := []struct {
+		op     string
+		vals   []string
+		lo, hi string
+		ok     bool
+	}{
+		{opBetween, nil, "", "", true},
+		{opBetween, []string{""}, "", "", true},
+		{opBetween, []string{"1,5"}, "1", "5", true},
+		{opBetween, []string{" 1 ", " 5 "}, "1", "5", true},
+		{opBetween, []string{"1"}, "1", "", true},
+		{opBetween, []string{"1,"}, "1", "", true},
+		{opBetween, []string{",5"}, "", "5", true},
+		{opBetween, []string{"1,2", "3"}, "", "", false},
+		{opDateRange, []string{"2024-01-01,2024-01-31"}, "2024-01-01", "2024-01-31", true},
+		{opDateRange, []string{"2024-01-01"}, "2024-01-01", "", true},
+	}
+	for _, tt := range tests {
+		lo, hi, ok := rangeValues(FilterDef{}, tt.op, tt.vals)
+		if lo != tt.lo || hi != tt.hi || ok != tt.ok {
+			t.Errorf("%s %q = %q, %q, %v, want %q, %q, %v", tt.op, tt.vals, lo, hi, ok, tt.lo, tt.hi, tt.ok)
+		}
+	}
+
+	lo, hi, ok := rangeValues(FilterDef{}, opDateRange, []string{"ytd"})
+	if !ok || lo == "" || hi == "" || lo > hi {
+		t.Errorf("ytd = %q, %q, %v, want a resolved preset", lo, hi, ok)
+	}
+}
@@ -0,0 +1,548 @@
+package datagrid
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// OperationError is returned when a write is attempted that datagrid.operations does not
+// enable (add, edit, delete), or on a query-mode catalog, which is read-only.
+type OperationError struct {
+	Operation string // add, edit or delete
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %s is not enabled for this catalog", e.Operation)
+}
+
+// ErrRowNotFound is returned when the key of an update or delete matches no row the
+// request may change.
+var ErrRowNotFound = errors.New("row not found")
+
+// ErrRowNotVisible is returned, and the write rolled back, when the written row cannot be
+// read back: a Row Level Security policy (or the catalog's source) hides it from the
+// request, which could not see or change it afterwards.
+var ErrRowNotVisible = errors.New("the written row would not be visible")
+
+// keyValue is one primary key column of a row and its value.
+type keyValue struct {
+	Column string
+	Type   string
+	Value  interface{}
+}
+
+// primaryKeys returns the key columns of the catalog's main object: the ColumnDef.PrimaryKey
+// columns, else an "id" column. Nil means rows cannot be addressed.
+func (h *Handler) primaryKeys() []ColumnDef {
+	if len(h.Catalog.Objects) == 0 {
+		return nil
+	}
+	var pks []ColumnDef
+	var id *ColumnDef
+	for i, col := range h.Catalog.Objects[0].Columns {
+		if col.PrimaryKey {
+			pks = append(pks, col)
+		}
+		if col.Name == "id" {
+			id = &h.Catalog.Objects[0].Columns[i]
+		}
+	}
+	if len(pks) == 0 && id != nil {
+		pks = []ColumnDef{*id}
+	}
+	return pks
+}
+
+// storedColumn returns the column of the main object named field when it is stored in
+// the table, i.e. not a lookup, computed or JSON column.
+func (h *Handler) storedColumn(field string) (ColumnDef, bool) {
+	if len(h.Catalog.Objects) == 0 {
+		return ColumnDef{}, false
+	}
+	for _, col := range h.Catalog.Objects[0].Columns {
+		if col.Name == field {
+			return col, col.From == "" && col.Expr == "" && col.Path == ""
+		}
+	}
+	return ColumnDef{}, false
+}
+
+// recordKey returns the JSON object of a fetched row's key ({"id": 42}), rendered as the
+// row's data-key so HTMX can send it back with hx-vals. "" when the row lacks a key column.
+func (h *Handler) recordKey(row map[string]interface{}) string {
+	pks := h.primaryKeys()
+	if len(pks) == 0 {
+		return ""
+	}
+	key := make(map[string]interface{}, len(pks))
+	for _, pk := range pks {
+		v, ok := row[pk.Name]
+		if !ok || v == nil {
+			return ""
+		}
+		key[pk.Name] = v
+	}
+	b, err := json.Marshal(key)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// allowWrite checks the operation against datagrid.operations.
+func (h *Handler) allowWrite(op string) error {
+	enabled := false
+	switch op {
+	case "add":
+		enabled = h.Config.Operations.Add
+	case "edit":
+		enabled = h.Config.Operations.Edit
+	case "delete":
+		enabled = h.Config.Operations.Delete
+	}
+	if !enabled || h.IsQueryMode || len(h.primaryKeys()) == 0 {
+		return &OperationError{Operation: op}
+	}
+	return nil
+}
+
+// rowKey reads the primary key of the addressed row from the submitted values.
+func (h *Handler) rowKey(values url.Values, verr *ValidationError) []keyValue {
+	var key []keyValue
+	for _, pk := range h.primaryKeys() {
+		raw := firstValue(values[pk.Name])
+		if raw == "" {
+			verr.add(pk.Name, "%s is required", pk.Name)
+			continue
+		}
+		v, err := writeScalar(strings.ToLower(strings.TrimSpace(pk.Type)), raw)
+		if err != nil {
+			verr.add(pk.Name, "%s", err.Error())
+			continue
+		}
+		key = append(key, keyValue{Column: pk.Name, Type: pk.Type, Value: v})
+	}
+	return key
+}
+
+// writeColumns coerces the submitted values of the stored columns by column type, in
+// catalog order. Key columns are skipped unless withKey; other names are ignored, and
+// columns restricted for the request's roles may not be written.
+func (h *Handler) writeColumns(values url.Values, access columnAccess, withKey bool, verr *ValidationError) ([]string, []interface{}) {
+	keys := map[string]bool{}
+	for _, pk := range h.primaryKeys() {
+		keys[pk.Name] = true
+	}
+	var cols []string
+	var args []interface{}
+	for _, col := range h.Catalog.Objects[0].Columns {
+		vals, submitted := values[col.Name]
+		if !submitted || (keys[col.Name] && !withKey) {
+			continue
+		}
+		if _, stored := h.storedColumn(col.Name); !stored {
+			continue
+		}
+		if access.restricted(col.Name) {
+			verr.add(col.Name, "column %s is not available", col.Name)
+			continue
+		}
+		v, err := h.writeValue(col, vals)
+		if err != nil {
+			verr.add(col.Name, "%s", err.Error())
+			continue
+		}
+		cols = append(cols, col.Name)
+		args = append(args, v)
+	}
+	return cols, args
+}
+
+// writeValue coerces a submitted form value to the column's type. Empty values are
+// written as NULL, except to plain text columns; values of LOV columns must be listed
+// in the LOV; array columns take repeated or comma-separated values.
+func (h *Handler) writeValue(col ColumnDef, vals []string) (interface{}, error) {
+	t := strings.ToLower(strings.TrimSpace(col.Type))
+	lov, _ := h.uiColumn(col.Name)
+
+	if base, isArray := strings.CutSuffix(t, "[]"); isArray {
+		items := []string{}
+		for _, v := range vals {
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item == "" {
+					continue
+				}
+				if _, err := writeScalar(base, item); err != nil {
+					return nil, err
+				}
+				if !inLOV(lov.LOV, item, item) {
+					return nil, fmt.Errorf("%q is not a valid choice", item)
+				}
+				items = append(items, item)
+			}
+		}
+		return pq.Array(items), nil
+	}
+
+	raw := firstValue(vals)
+	if raw == "" {
+		if isTextType(t) && len(lov.LOV) == 0 {
+			return "", nil
+		}
+		return nil, nil
+	}
+	v, err := writeScalar(t, raw)
+	if err != nil {
+		return nil, err
+	}
+	if !inLOV(lov.LOV, raw, v) {
+		return nil, fmt.Errorf("%q is not a valid choice", raw)
+	}
+	return v, nil
+}
+
+// inLOV reports whether the submitted value (as typed, or after coercion) is one of the
+// LOV's values; columns without an LOV accept anything.
+func inLOV(items []LOVItem, raw string, v interface{}) bool {
+	if len(items) == 0 {
+		return true
+	}
+	coerced := fmt.Sprintf("%v", v)
+	for _, item := range items {
+		if s := fmt.Sprintf("%v", item.Value); s == raw || s == coerced {
+			return true
+		}
+	}
+	return false
+}
+
+// timestampLayouts are the forms a timestamp may be submitted in (datetime-local inputs
+// send the first).
+var timestampLayouts = []string{
+	"2006-01-02T15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	time.RFC3339,
+	"2006-01-02",
+}
+
+// writeScalar parses a single non-empty value for the (lower-case) column type.
+// Timestamps and JSON are passed on as text once checked, so Postgres converts them to
+// the column's type.
+func writeScalar(t, v string) (interface{}, error) {
+	switch {
+	case t == "int_bool":
+		b, err := parseFormBool(v)
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case t == "bool" || t == "boolean":
+		return parseFormBool(v)
+	case t == "serial" || t == "bigserial" || t == "smallserial":
+		return convertParamValue("bigint", v)
+	case t == "json" || t == "jsonb":
+		if !json.Valid([]byte(v)) {
+			return nil, fmt.Errorf("invalid JSON")
+		}
+		return v, nil
+	case strings.HasPrefix(t, "timestamp"):
+		for _, layout := range timestampLayouts {
+			if _, err := time.Parse(layout, v); err == nil {
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid timestamp %q", v)
+	case t == "double" || t == "number":
+		return convertParamValue("float8", v)
+	}
+	return convertParamValue(t, v)
+}
+
+// parseFormBool accepts strconv.ParseBool's forms and the "on"/"off" of checkboxes.
+func parseFormBool(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "on", "yes":
+		return true, nil
+	case "off", "no":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean %q", v)
+	}
+	return b, nil
+}
+
+func isTextType(t string) bool {
+	return t == "" || t == "text" || t == "citext" || strings.HasPrefix(t, "varchar") ||
+		strings.HasPrefix(t, "character") || strings.HasPrefix(t, "char")
+}
+
+// keyWhere renders "pk1" = $n AND ... for the row key, numbering from start.
+func keyWhere(key []keyValue, start int) (string, []interface{}) {
+	conds := make([]string, len(key))
+	args := make([]interface{}, len(key))
+	for i, k := range key {
+		conds[i] = fmt.Sprintf("%s = $%d", quote_ident(k.Column), start+i)
+		args[i] = k.Value
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// compileRowKey restricts a statement to one row (RequestParams.rowKey).
+func (h *Handler) compileRowKey(b *whereBuilder, key []keyValue) {
+	for _, k := range key {
+		b.add(fmt.Sprintf("%s = %s", h.columnExpr(k.Column), b.bind(k.Value, columnCast(k.Type))))
+	}
+}
+
+// InsertRowContext inserts a row from submitted form values (datagrid.operations.add) and
+// returns it as the grid renders it. Columns not submitted get their default.
+func (h *Handler) InsertRowContext(ctx context.Context, values url.Values) (*TableResult, error) {
+	if err := h.allowWrite("add"); err != nil {
+		return nil, err
+	}
+	p := RequestParams{}
+	if err := h.resolveAccess(ctx, &p); err != nil {
+		return nil, err
+	}
+	verr := &ValidationError{}
+	cols, args := h.writeColumns(values, p.access, true, verr)
+	if len(verr.Errors) > 0 {
+		return nil, verr
+	}
+
+	pks := h.primaryKeys()
+	returning := make([]string, len(pks))
+	for i, pk := range pks {
+		returning[i] = quote_ident(pk.Name)
+	}
+	query := fmt.Sprintf("INSERT INTO %s DEFAULT VALUES RETURNING %s", quote_ident(h.TableName), strings.Join(returning, ", "))
+	if len(cols) > 0 {
+		names := make([]string, len(cols))
+		binds := make([]string, len(cols))
+		for i, c := range cols {
+			names[i], binds[i] = quote_ident(c), fmt.Sprintf("$%d", i+1)
+		}
+		query = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) RETURNING %s", quote_ident(h.TableName),
+			strings.Join(names, ", "), strings.Join(binds, ", "), strings.Join(returning, ", "))
+	}
+
+	tx, err := h.beginQueryTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	dest := make([]interface{}, len(pks))
+	ptrs := make([]interface{}, len(pks))
+	for i := range dest {
+		ptrs[i] = &dest[i]
+	}
+	if err := tx.QueryRowContext(ctx, query, args...).Scan(ptrs...); err != nil {
+		return nil, h.writeError(ctx, "insert", query, err)
+	}
+	key := make([]keyValue, len(pks))
+	for i, pk := range pks {
+		v := dest[i]
+		if b, ok := v.([]byte); ok {
+			v = string(b)
+		}
+		key[i] = keyValue{Column: pk.Name, Type: pk.Type, Value: v}
+	}
+	return h.writtenRow(ctx, tx, p, key)
+}
+
+// UpdateRowContext updates the submitted columns of the row addressed by the primary key
+// values (datagrid.operations.edit) and returns the refreshed row. Key columns are not
+// changed; ErrRowNotFound means no row the request may change has that key.
+func (h *Handler) UpdateRowContext(ctx context.Context, values url.Values) (*TableResult, error) {
+	if err := h.allowWrite("edit"); err != nil {
+		return nil, err
+	}
+	p := RequestParams{}
+	if err := h.resolveAccess(ctx, &p); err != nil {
+		return nil, err
+	}
+	verr := &ValidationError{}
+	key := h.rowKey(values, verr)
+	cols, args := h.writeColumns(values, p.access, false, verr)
+	if len(verr.Errors) > 0 {
+		return nil, verr
+	}
+
+	tx, err := h.beginQueryTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if len(cols) > 0 {
+		sets := make([]string, len(cols))
+		for i, c := range cols {
+			sets[i] = fmt.Sprintf("%s = $%d", quote_ident(c), i+1)
+		}
+		where, keyArgs := keyWhere(key, len(args)+1)
+		query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", quote_ident(h.TableName), strings.Join(sets, ", "), where)
+		res, err := tx.ExecContext(ctx, query, append(args, keyArgs...)...)
+		if err != nil {
+			return nil, h.writeError(ctx, "update", query, err)
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return nil, ErrRowNotFound
+		}
+	}
+	res, err := h.writtenRow(ctx, tx, p, key)
+	if len(cols) == 0 && errors.Is(err, ErrRowNotVisible) {
+		return nil, ErrRowNotFound // nothing was written
+	}
+	return res, err
+}
+
+// DeleteRowContext deletes the row addressed by the primary key values
+// (datagrid.operations.delete).
+func (h *Handler) DeleteRowContext(ctx context.Context, values url.Values) error {
+	if err := h.allowWrite("delete"); err != nil {
+		return err
+	}
+	verr := &ValidationError{}
+	key := h.rowKey(values, verr)
+	if len(verr.Errors) > 0 {
+		return verr
+	}
+
+	tx, err := h.beginQueryTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	where, args := keyWhere(key, 1)
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s", quote_ident(h.TableName), where)
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return h.writeError(ctx, "delete", query, err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrRowNotFound
+	}
+	return tx.Commit()
+}
+
+// writtenRow reads the written row back in tx with the grid statement, so it carries the
+// same LOV labels, masks and styling as a fetched page, then commits. A row the request
+// cannot read back is not committed (ErrRowNotVisible; the caller rolls tx back).
+func (h *Handler) writtenRow(ctx context.Context, tx *sql.Tx, p RequestParams, key []keyValue) (*TableResult, error) {
+	h.resolveVersion(ctx)
+	p.rowKey = key
+	query, configJSON, _, err := h.buildGridSQL(p)
+	if err != nil {
+		return nil, err
+	}
+	records, err := h.runStatement(ctx, tx, query, configJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read written row: %w", h.queryError(ctx, err))
+	}
+	if len(records) == 0 {
+		return nil, ErrRowNotVisible
+	}
+	h.decorateRecords(records)
+	return h.newTableResult(records, len(records), p), tx.Commit()
+}
+
+func (h *Handler) writeError(ctx context.Context, op, query string, err error) error {
+	if os.Getenv("DEBUG_SQL") == "true" {
+		fmt.Printf("--- WRITE SQL ERROR ---\nQuery: %s\nError: %v\n------------------------\n", query, err)
+	}
+	return fmt.Errorf("failed to %s row: %w", op, h.queryError(ctx, err))
+}
+
+// ServeRow is the write endpoint: POST inserts, PUT or PATCH updates and DELETE deletes
+// the row named by the primary key form values. Inserts and updates respond with the
+// refreshed <tr> (template "datagrid_rows") for HTMX to swap in, deletes with an empty
+// body so hx-swap="outerHTML" removes the row. Disabled operations and rows the request
+// could not read back are answered with 403, invalid values with 422 and unknown rows
+// with 404.
+func (h *Handler) ServeRow(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var res *TableResult
+	var err error
+	status := http.StatusOK
+	switch r.Method {
+	case http.MethodPost:
+		res, err = h.InsertRowContext(r.Context(), r.Form)
+		status = http.StatusCreated
+	case http.MethodPut, http.MethodPatch:
+		res, err = h.UpdateRowContext(r.Context(), r.Form)
+	case http.MethodDelete:
+		err = h.DeleteRowContext(r.Context(), r.Form)
+	default:
+		w.Header().Set("Allow", "POST, PUT, PATCH, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		writeStatusError(w, r, err)
+		return
+	}
+	if res == nil {
+		w.WriteHeader(status)
+		return
+	}
+
+	tmpl, err := template.New("datagrid_rows").Funcs(TemplateFuncs()).ParseFS(UIAssets,
+		"ui/templates/partials/datagrid/table.html",
+	)
+	if err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	res.ListEndpoint = h.ListEndpoint
+	w.WriteHeader(status)
+	if err := tmpl.ExecuteTemplate(w, "datagrid_rows", res); err != nil {
+		slog.Error("datagrid render error", "error", err)
+	}
+}
+
+// writeStatusError answers a failed write with the status matching its error.
+func writeStatusError(w http.ResponseWriter, r *http.Request, err error) {
+	var operr *OperationError
+	var verr *ValidationError
+	var terr *TimeoutError
+	switch {
+	case errors.As(err, &operr) || errors.Is(err, ErrNoRowVersion) || errors.Is(err, ErrRowNotVisible):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.As(err, &verr):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, ErrRowNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.As(err, &terr):
+		http.Error(w, err.Error(), http.StatusGatewayTimeout)
+	case r.Context().Err() != nil:
+		// client went away
+	default:
+		slog.Error("datagrid write error", "method", r.Method, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
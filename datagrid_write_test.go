@@ -0,0 +1,237 @@
+package datagrid
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+const writeCatalog = `{
+	"version": "2.0",
+	"title": "Orders",
+	"objects": [{"name": "app.orders", "columns": [
+		{"name": "id", "type": "integer", "primary_key": true},
+		{"name": "name", "type": "text"},
+		{"name": "qty", "type": "integer"},
+		{"name": "price", "type": "numeric"},
+		{"name": "status", "type": "text"},
+		{"name": "priority", "type": "integer"},
+		{"name": "tags", "type": "text[]"},
+		{"name": "sizes", "type": "integer[]"},
+		{"name": "data", "type": "jsonb"},
+		{"name": "total", "type": "numeric", "expr": "qty * price"},
+		{"name": "city", "type": "text", "path": "data.city"}
+	]}],
+	"datagrid": {
+		"operations": {"add": true, "edit": true},
+		"columns": {
+			"id": {}, "name": {}, "qty": {}, "price": {}, "data": {}, "total": {}, "city": {},
+			"status": {"lov": [{"value": "A", "label": "Active"}, {"value": "T", "label": "Terminated"}]},
+			"priority": {"lov": [{"value": 1, "label": "High"}, {"value": 2, "label": "Low"}]},
+			"tags": {"lov": [{"value": "red", "label": "Red"}, {"value": "blue", "label": "Blue"}]},
+			"sizes": {}
+		}
+	}
+}`
+
+func writeHandler(t *testing.T) *Handler {
+	t.Helper()
+	h, err := NewHandlerFromData(nil, []byte(writeCatalog), "en")
+	if err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	return h
+}
+
+func TestWriteScalar(t *testing.T) {
+	tests := []struct {
+		typ, value string
+		want       interface{}
+		err        string
+	}{
+		{"int_bool", "on", int64(1), ""},
+		{"int_bool", "0", int64(0), ""},
+		{"int_bool", "maybe", nil, `invalid boolean "maybe"`},
+		{"boolean", "off", false, ""},
+		{"bool", "yes", true, ""},
+		{"boolean", "TRUE", true, ""},
+		{"boolean", "2", nil, `invalid boolean "2"`},
+		{"serial", "42", int64(42), ""},
+		{"bigserial", "4.2", nil, `invalid integer "4.2"`},
+		{"integer", "-7", int64(-7), ""},
+		{"smallint", "7; DROP TABLE t", nil, `invalid integer "7; DROP TABLE t"`},
+		{"numeric", "12.50", "12.50", ""},
+		{"numeric(10,2)", "abc", nil, `invalid number "abc"`},
+		{"number", "1e3", "1e3", ""},
+		{"double", "x", nil, `invalid number "x"`},
+		{"jsonb", `{"a": [1, 2]}`, `{"a": [1, 2]}`, ""},
+		{"json", "{a: 1}", nil, "invalid JSON"},
+		{"timestamptz", "2024-05-01T10:30", "2024-05-01T10:30", ""},
+		{"timestamp", "2024-05-01 10:30:00", "2024-05-01 10:30:00", ""},
+		{"timestamp with time zone", "2024-05-01T10:30:00+02:00", "2024-05-01T10:30:00+02:00", ""},
+		{"timestamptz", "2024-05-01", "2024-05-01", ""},
+		{"timestamptz", "yesterday", nil, `invalid timestamp "yesterday"`},
+		{"date", "2024-02-29", "2024-02-29", ""},
+		{"date", "2024-02-30", nil, `invalid date "2024-02-30"`},
+		{"text", "it's", "it's", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.typ+" "+tt.value, func(t *testing.T) {
+			got, err := writeScalar(tt.typ, tt.value)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("value = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteValue(t *testing.T) {
+	h := writeHandler(t)
+	tests := []struct {
+		column string
+		vals   []string
+		want   interface{}
+		err    string
+	}{
+		{"name", []string{""}, "", ""},
+		{"name", []string{"  Ann  "}, "Ann", ""},
+		{"qty", []string{""}, nil, ""},
+		{"qty", []string{"3"}, int64(3), ""},
+		{"qty", []string{"three"}, nil, `invalid integer "three"`},
+		{"status", []string{""}, nil, ""},
+		{"status", []string{"A"}, "A", ""},
+		{"status", []string{"Active"}, nil, `"Active" is not a valid choice`},
+		{"status", []string{"X' OR '1'='1"}, nil, `"X' OR '1'='1" is not a valid choice`},
+		{"priority", []string{"02"}, int64(2), ""},
+		{"priority", []string{"3"}, nil, `"3" is not a valid choice`},
+		{"tags", []string{"red,blue", " red "}, pq.Array([]string{"red", "blue", "red"}), ""},
+		{"tags", nil, pq.Array([]string{}), ""},
+		{"tags", []string{"red,green"}, nil, `"green" is not a valid choice`},
+		{"sizes", []string{"1,2"}, pq.Array([]string{"1", "2"}), ""},
+		{"sizes", []string{"1,x"}, nil, `invalid integer "x"`},
+		{"data", []string{`{"city": "Pécs"}`}, `{"city": "Pécs"}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %q", tt.column, tt.vals), func(t *testing.T) {
+			col, ok := h.storedColumn(tt.column)
+			if !ok {
+				t.Fatalf("%s is not stored", tt.column)
+			}
+			got, err := h.writeValue(col, tt.vals)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("value = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteColumns(t *testing.T) {
+	h := writeHandler(t)
+	values := url.Values{
+		"id":      {"7"},
+		"name":    {"Ann"},
+		"total":   {"100"},  // computed
+		"city":    {"Pécs"}, // JSON column
+		"unknown": {"x"},    // not a column
+		"price":   {"9.90"}, // restricted below
+		"qty":     {"2"},
+		"status":  {"A", "ignored"},
+	}
+
+	verr := &ValidationError{}
+	cols, args := h.writeColumns(values, nil, false, verr)
+	if len(verr.Errors) > 0 {
+		t.Fatal(verr)
+	}
+	if want := []string{"name", "qty", "price", "status"}; !reflect.DeepEqual(cols, want) {
+		t.Errorf("columns = %v, want %v", cols, want)
+	}
+	if want := []interface{}{"Ann", int64(2), "9.90", "A"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %#v, want %#v", args, want)
+	}
+
+	cols, _ = h.writeColumns(values, nil, true, verr)
+	if len(cols) == 0 || cols[0] != "id" {
+		t.Errorf("columns with key = %v, want id first", cols)
+	}
+
+	verr = &ValidationError{}
+	cols, _ = h.writeColumns(values, columnAccess{"price": accessHidden}, false, verr)
+	if len(verr.Errors) != 1 || !strings.Contains(verr.Error(), "column price is not available") {
+		t.Errorf("restricted column: %v", verr)
+	}
+	for _, c := range cols {
+		if c == "price" {
+			t.Error("restricted column written")
+		}
+	}
+
+	for _, field := range []string{"total", "city"} {
+		if _, stored := h.storedColumn(field); stored {
+			t.Errorf("%s counts as stored", field)
+		}
+	}
+}
+
+func TestAllowWrite(t *testing.T) {
+	h := writeHandler(t)
+	var operr *OperationError
+	if err := h.allowWrite("add"); err != nil {
+		t.Errorf("add: %v", err)
+	}
+	if err := h.allowWrite("delete"); !errors.As(err, &operr) || operr.Operation != "delete" {
+		t.Errorf("delete: err = %v, want an OperationError", err)
+	}
+	h.IsQueryMode = true
+	if err := h.allowWrite("edit"); !errors.As(err, &operr) {
+		t.Errorf("query mode edit: err = %v, want an OperationError", err)
+	}
+}
+
+func TestWriteStatusError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{&OperationError{Operation: "add"}, http.StatusForbidden},
+		{ErrNoRowVersion, http.StatusForbidden},
+		{ErrRowNotVisible, http.StatusForbidden},
+		{&ValidationError{Errors: []ParamError{{Field: "qty", Message: "invalid"}}}, http.StatusUnprocessableEntity},
+		{ErrRowNotFound, http.StatusNotFound},
+		{fmt.Errorf("update: %w", ErrRowNotFound), http.StatusNotFound},
+		{&TimeoutError{Err: errors.New("canceling statement")}, http.StatusGatewayTimeout},
+		{errors.New("boom"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		writeStatusError(w, httptest.NewRequest(http.MethodPost, "/row", nil), tt.err)
+		if w.Code != tt.want {
+			t.Errorf("%v: status = %d, want %d", tt.err, w.Code, tt.want)
+		}
+	}
+}
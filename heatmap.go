@@ -1,6 +1,7 @@
 package datagrid
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"io"
@@ -211,6 +212,16 @@ func buildLegendGradient(scale string) string {
 
 // ── Data builder ──
 
+// HeatmapDataContext builds the heatmap from the rows matching the request's filters and
+// search (see FetchRecordsContext), so it covers the same row set as the grid.
+func (h *Handler) HeatmapDataContext(ctx context.Context, p RequestParams, cfg *HeatmapConfig) (*HeatmapResult, error) {
+	records, err := h.FetchRecordsContext(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return HeatmapData(records, cfg), nil
+}
+
 // HeatmapData builds a HeatmapResult from flat SQL records and a HeatmapConfig.
 func HeatmapData(records []map[string]interface{}, cfg *HeatmapConfig) *HeatmapResult {
 	if cfg == nil || len(records) == 0 {
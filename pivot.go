@@ -1,6 +1,7 @@
 package datagrid
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -20,15 +21,209 @@ type PivotResult struct {
 	GrandTotal    map[string]float64
 }
 
-// PivotData performs the aggregation logic for a pivot view
+// PivotData runs PivotDataContext without a request context.
 func (h *Handler) PivotData(p RequestParams) (*PivotResult, error) {
+	return h.PivotDataContext(context.Background(), p)
+}
+
+// PivotDataContext performs the aggregation logic for a pivot view. The query is
+// cancelled with ctx and limited by the catalog timeout.
+func (h *Handler) PivotDataContext(ctx context.Context, p RequestParams) (*PivotResult, error) {
 	if h.Config.Pivot == nil {
 		return nil, fmt.Errorf("pivot configuration missing")
 	}
 
 	conf := h.Config.Pivot
+	if err := h.resolveAccess(ctx, &p); err != nil {
+		return nil, err
+	}
+
+	// 1. Render the statement, 2. fetch records
+	query, configJSON, resMeasures, err := h.buildPivotSQL(p)
+	if err != nil {
+		return nil, err
+	}
+	if os.Getenv("DEBUG_SQL") == "true" {
+		fmt.Printf("--- PIVOT SQL ---\n%s\n-----------------\n", query)
+	}
+	tx, err := h.beginQueryTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	h.applySearchSettings(ctx, tx)
+
+	records, err := h.runStatement(ctx, tx, query, configJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute pivot template SQL: %w", h.queryError(ctx, err))
+	}
+
+	res := &PivotResult{
+
+		Measures:      resMeasures,
+		DisplayLabels: make(map[string]string),
+		DimensionCSS:  make(map[string]string),
+		Data:          make(map[string]map[string]map[string]float64),
+		RowTotals:     make(map[string]map[string]float64),
+		ColTotals:     make(map[string]map[string]float64),
+		GrandTotal:    make(map[string]float64),
+	}
+
+	// Build dimension metadata
+	colMeta := make(map[string]string)
+	for _, c := range h.Columns {
+		colMeta[c.Field] = c.Display
+	}
+
+	for _, r := range conf.Rows {
+		res.DisplayLabels[r.Column] = colMeta[r.Column]
+		if res.DisplayLabels[r.Column] == "" {
+			res.DisplayLabels[r.Column] = r.Column
+		}
+		res.DimensionCSS[r.Column] = r.CSS
+	}
+	for _, c := range conf.Columns {
+		res.DisplayLabels[c.Column] = colMeta[c.Column]
+		if res.DisplayLabels[c.Column] == "" {
+			res.DisplayLabels[c.Column] = c.Column
+		}
+		res.DimensionCSS[c.Column] = c.CSS
+	}
+
+	rowKeySet := make(map[string]bool)
+	colKeySet := make(map[string]bool)
+
+	numRows := len(conf.Rows)
+	numCols := len(conf.Columns)
+	numVals := len(conf.Values)
+
+	for _, row := range records {
+		rKeys := []string{}
+		for i := 0; i < numRows; i++ {
+			field := conf.Rows[i].Column
+			val := row[field]
+			valStr := "(null)"
+			if val != nil {
+				valStr = strings.TrimSpace(fmt.Sprintf("%v", val))
+			}
+			rKeys = append(rKeys, valStr)
+		}
+		rKey := strings.Join(rKeys, " | ")
+
+		if !rowKeySet[rKey] {
+			rowKeySet[rKey] = true
+			res.Rows = append(res.Rows, rKey)
+		}
+
+		cKeys := []string{}
+		for i := 0; i < numCols; i++ {
+			field := conf.Columns[i].Column
+			val := row[field]
+			valStr := "(null)"
+			if val != nil {
+				valStr = strings.TrimSpace(fmt.Sprintf("%v", val))
+			}
+			cKeys = append(cKeys, valStr)
+		}
+		cKey := strings.Join(cKeys, " | ")
+
+		if !colKeySet[cKey] {
+			colKeySet[cKey] = true
+			res.Cols = append(res.Cols, cKey)
+		}
 
-	// 1. Prepare JSON config for datagrid_get_pivot_sql
+		// Values extraction
+		if res.Data[rKey] == nil {
+			res.Data[rKey] = make(map[string]map[string]float64)
+		}
+		if res.Data[rKey][cKey] == nil {
+			res.Data[rKey][cKey] = make(map[string]float64)
+		}
+		if res.RowTotals[rKey] == nil {
+			res.RowTotals[rKey] = make(map[string]float64)
+		}
+		if res.ColTotals[cKey] == nil {
+			res.ColTotals[cKey] = make(map[string]float64)
+		}
+
+		for i := 0; i < numVals; i++ {
+			alias := fmt.Sprintf("val%d", i)
+			valRaw := row[alias]
+			mKey := resMeasures[i]
+			var val float64
+
+			switch v := valRaw.(type) {
+			case float64:
+				val = v
+			case int64:
+				val = float64(v)
+			case float32:
+				val = float64(v)
+			case int:
+				val = float64(v)
+			case string:
+				fmt.Sscanf(v, "%f", &val)
+			default:
+				fmt.Sscanf(fmt.Sprintf("%v", v), "%f", &val)
+			}
+
+			if conf.Multiplier != 0 {
+				val *= conf.Multiplier
+			}
+
+			res.Data[rKey][cKey][mKey] = val
+			res.RowTotals[rKey][mKey] += val
+			res.ColTotals[cKey][mKey] += val
+			res.GrandTotal[mKey] += val
+
+			// Subtotal injection
+			if conf.Subtotals {
+				// Row subtotals
+				if numRows > 1 {
+					for length := 1; length < numRows; length++ {
+						subRKey := strings.Join(rKeys[:length], " | ") + " (Total)"
+						if res.Data[subRKey] == nil {
+							res.Data[subRKey] = make(map[string]map[string]float64)
+							if !rowKeySet[subRKey] {
+								rowKeySet[subRKey] = true
+								res.Rows = append(res.Rows, subRKey)
+							}
+						}
+						if res.Data[subRKey][cKey] == nil {
+							res.Data[subRKey][cKey] = make(map[string]float64)
+						}
+						res.Data[subRKey][cKey][mKey] += val
+					}
+				}
+				// Col subtotals
+				if numCols > 1 {
+					for length := 1; length < numCols; length++ {
+						subCKey := strings.Join(cKeys[:length], " | ") + " (Total)"
+						if res.Data[rKey][subCKey] == nil {
+							res.Data[rKey][subCKey] = make(map[string]float64)
+							if !colKeySet[subCKey] {
+								colKeySet[subCKey] = true
+								res.Cols = append(res.Cols, subCKey)
+							}
+						}
+						res.Data[rKey][subCKey][mKey] += val
+					}
+				}
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// buildPivotSQL renders the pivot statement (pivot.sql) with its JSON config and returns
+// the measure labels in column order.
+func (h *Handler) buildPivotSQL(p RequestParams) (string, string, []string, error) {
+	h.ensureAccess(&p)
+	conf := h.Config.Pivot
+
+	// Prepare JSON config for datagrid_get_pivot_sql
 	type DimDecl struct {
 		Column string `json:"column"`
 		IsLOV  bool   `json:"isLOV"`
@@ -49,6 +244,7 @@ func (h *Handler) PivotData(p RequestParams) (*PivotResult, error) {
 		ValuesJSON string     `json:"valuesJSON,omitempty"`
 		IsBoolean  bool       `json:"-"`
 		IsNumber   bool       `json:"-"`
+		Source     string     `json:"-"` // SQL expression of the column
 	}
 
 	config := make(map[string]interface{})
@@ -63,7 +259,7 @@ func (h *Handler) PivotData(p RequestParams) (*PivotResult, error) {
 		d := DimDecl{Column: r.Column}
 		// Check if it's an LOV
 		for _, col := range h.Columns {
-			if col.Field == r.Column && len(col.LOV) > 0 {
+			if col.Field == r.Column && len(col.LOV) > 0 && !p.access.restricted(col.Field) {
 				d.IsLOV = true
 				if idx, ok := lovMapIdx[r.Column]; ok {
 					d.LovIdx = idx
@@ -84,6 +280,7 @@ func (h *Handler) PivotData(p RequestParams) (*PivotResult, error) {
 					isNum := strings.ToLower(col.Type) == "integer" || strings.ToLower(col.Type) == "numeric" || strings.ToLower(col.Type) == "double"
 					lovsDecl = append(lovsDecl, LOVDecl{
 						Column:     r.Column,
+						Source:     h.columnExpr(r.Column),
 						Values:     entries,
 						ValuesJSON: string(valJSON),
 						IsBoolean:  isBool,
@@ -100,7 +297,7 @@ func (h *Handler) PivotData(p RequestParams) (*PivotResult, error) {
 	for _, c := range conf.Columns {
 		d := DimDecl{Column: c.Column}
 		for _, col := range h.Columns {
-			if col.Field == c.Column && len(col.LOV) > 0 {
+			if col.Field == c.Column && len(col.LOV) > 0 && !p.access.restricted(col.Field) {
 				d.IsLOV = true
 				if idx, ok := lovMapIdx[c.Column]; ok {
 					d.LovIdx = idx
@@ -121,6 +318,7 @@ func (h *Handler) PivotData(p RequestParams) (*PivotResult, error) {
 					isNum := strings.ToLower(col.Type) == "integer" || strings.ToLower(col.Type) == "numeric" || strings.ToLower(col.Type) == "double"
 					lovsDecl = append(lovsDecl, LOVDecl{
 						Column:     c.Column,
+						Source:     h.columnExpr(c.Column),
 						Values:     entries,
 						ValuesJSON: string(valJSON),
 						IsBoolean:  isBool,
@@ -161,11 +359,17 @@ func (h *Handler) PivotData(p RequestParams) (*PivotResult, error) {
 	config["dimensions"] = dimsDecl
 	config["measures"] = measuresDecl
 	config["lovs"] = lovsDecl
-	config["filters"] = p.Filters
 
-	configJSON, _ := json.Marshal(config)
+	// Same filters and search as the grid, bound through the config "args" array;
+	// smart-filter conditions on measures become HAVING
+	p.measures = &measureScope{values: conf.Values}
+	pred, err := h.compileWhere(p, configArgs, h.fromClause())
+	if err != nil {
+		return "", "", nil, err
+	}
+	config["args"] = pred.Args
 
-	// 2. Fetch Records
+	configJSON, _ := json.Marshal(config)
 
 	// --- Hybrid Mode: Go Template Based Generation ---
 	type DimWrap struct {
@@ -176,19 +380,16 @@ func (h *Handler) PivotData(p RequestParams) (*PivotResult, error) {
 		Func   string
 		Column string
 		Alias  string
-	}
-	type FilterWrap struct {
-		Column    string
-		IsArray   bool
-		IsBoolean bool
-		IsNumber  bool
-		Values    []string
-		Value     string
+		SQL    string // Aggregate expression
 	}
 
 	dims := []DimWrap{}
 	for _, d := range dimsDecl {
-		src := "src." + quote_ident(d.Column)
+		// Restricted dimensions group by their mask; hidden ones fall into one (null) group
+		src := h.projectedExpr(p.access, d.Column)
+		if src == "" {
+			src = "NULL::text"
+		}
 		if d.IsLOV {
 			src = "lov" + fmt.Sprintf("%d", d.LovIdx) + ".label"
 		}
@@ -197,224 +398,31 @@ func (h *Handler) PivotData(p RequestParams) (*PivotResult, error) {
 
 	measures := []MeasureWrap{}
 	for _, m := range measuresDecl {
+		sql := h.measureSQL(PivotValueConfig{Column: m.Column, Func: m.Func})
+		if h.restrictedField(p.access, m.Column) {
+			sql = "NULL::numeric"
+		}
 		measures = append(measures, MeasureWrap{
 			Func:   m.Func,
 			Column: m.Column,
 			Alias:  m.Alias,
+			SQL:    sql,
 		})
 	}
 
-	filtersWrap := []FilterWrap{}
-	for k, v := range p.Filters {
-		// Skip technical parameters that are not defined as filters in the catalog
-		if _, ok := h.Config.Filters[k]; !ok {
-			continue
-		}
-
-		f := FilterWrap{Column: k}
-		if conf, ok := h.Config.Filters[k]; ok {
-			switch conf.Type {
-			case "boolean":
-				f.IsBoolean = true
-			case "integer", "numeric", "double":
-				f.IsNumber = true
-			}
-		}
-		if len(v) > 1 {
-			f.IsArray = true
-			f.Values = v
-		} else if len(v) == 1 {
-			f.Value = v[0]
-		}
-		filtersWrap = append(filtersWrap, f)
-	}
-
 	tplData := map[string]interface{}{
 		"TableName":  h.TableName,
+		"Joins":      h.joins,
 		"Dimensions": dims,
 		"Measures":   measures,
 		"LOVs":       lovsDecl,
-		"Filters":    filtersWrap,
+		"Where":      pred.SQL,
+		"Having":     pred.Having,
 	}
 
 	query, err := h.renderSQL("pivot.sql", tplData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to render pivot SQL template: %w", err)
-	}
-	if os.Getenv("DEBUG_SQL") == "true" {
-		fmt.Printf("--- PIVOT SQL ---\n%s\n-----------------\n", query)
-	}
-	rows, err := h.DB.Query("SELECT datagrid.datagrid_execute_json($1, $2)", query, string(configJSON))
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute pivot template SQL: %w", err)
-	}
-	defer rows.Close()
-
-	records := []map[string]interface{}{}
-	for rows.Next() {
-		var rowJSON string
-		if err := rows.Scan(&rowJSON); err == nil {
-			var row map[string]interface{}
-			if err := json.Unmarshal([]byte(rowJSON), &row); err == nil {
-				records = append(records, row)
-			}
-		}
-	}
-
-	res := &PivotResult{
-
-		Measures:      resMeasures,
-		DisplayLabels: make(map[string]string),
-		DimensionCSS:  make(map[string]string),
-		Data:          make(map[string]map[string]map[string]float64),
-		RowTotals:     make(map[string]map[string]float64),
-		ColTotals:     make(map[string]map[string]float64),
-		GrandTotal:    make(map[string]float64),
-	}
-
-	// Build dimension metadata
-	colMeta := make(map[string]string)
-	for _, c := range h.Columns {
-		colMeta[c.Field] = c.Display
-	}
-
-	for _, r := range conf.Rows {
-		res.DisplayLabels[r.Column] = colMeta[r.Column]
-		if res.DisplayLabels[r.Column] == "" {
-			res.DisplayLabels[r.Column] = r.Column
-		}
-		res.DimensionCSS[r.Column] = r.CSS
+		return "", "", nil, fmt.Errorf("failed to render pivot SQL template: %w", err)
 	}
-	for _, c := range conf.Columns {
-		res.DisplayLabels[c.Column] = colMeta[c.Column]
-		if res.DisplayLabels[c.Column] == "" {
-			res.DisplayLabels[c.Column] = c.Column
-		}
-		res.DimensionCSS[c.Column] = c.CSS
-	}
-
-	rowKeySet := make(map[string]bool)
-	colKeySet := make(map[string]bool)
-
-	numRows := len(conf.Rows)
-	numCols := len(conf.Columns)
-	numVals := len(conf.Values)
-
-	for _, row := range records {
-		rKeys := []string{}
-		for i := 0; i < numRows; i++ {
-			field := conf.Rows[i].Column
-			val := row[field]
-			valStr := "(null)"
-			if val != nil {
-				valStr = strings.TrimSpace(fmt.Sprintf("%v", val))
-			}
-			rKeys = append(rKeys, valStr)
-		}
-		rKey := strings.Join(rKeys, " | ")
-
-		if !rowKeySet[rKey] {
-			rowKeySet[rKey] = true
-			res.Rows = append(res.Rows, rKey)
-		}
-
-		cKeys := []string{}
-		for i := 0; i < numCols; i++ {
-			field := conf.Columns[i].Column
-			val := row[field]
-			valStr := "(null)"
-			if val != nil {
-				valStr = strings.TrimSpace(fmt.Sprintf("%v", val))
-			}
-			cKeys = append(cKeys, valStr)
-		}
-		cKey := strings.Join(cKeys, " | ")
-
-		if !colKeySet[cKey] {
-			colKeySet[cKey] = true
-			res.Cols = append(res.Cols, cKey)
-		}
-
-		// Values extraction
-		if res.Data[rKey] == nil {
-			res.Data[rKey] = make(map[string]map[string]float64)
-		}
-		if res.Data[rKey][cKey] == nil {
-			res.Data[rKey][cKey] = make(map[string]float64)
-		}
-		if res.RowTotals[rKey] == nil {
-			res.RowTotals[rKey] = make(map[string]float64)
-		}
-		if res.ColTotals[cKey] == nil {
-			res.ColTotals[cKey] = make(map[string]float64)
-		}
-
-		for i := 0; i < numVals; i++ {
-			alias := fmt.Sprintf("val%d", i)
-			valRaw := row[alias]
-			mKey := resMeasures[i]
-			var val float64
-
-			switch v := valRaw.(type) {
-			case float64:
-				val = v
-			case int64:
-				val = float64(v)
-			case float32:
-				val = float64(v)
-			case int:
-				val = float64(v)
-			case string:
-				fmt.Sscanf(v, "%f", &val)
-			default:
-				fmt.Sscanf(fmt.Sprintf("%v", v), "%f", &val)
-			}
-
-			if conf.Multiplier != 0 {
-				val *= conf.Multiplier
-			}
-
-			res.Data[rKey][cKey][mKey] = val
-			res.RowTotals[rKey][mKey] += val
-			res.ColTotals[cKey][mKey] += val
-			res.GrandTotal[mKey] += val
-
-			// Subtotal injection
-			if conf.Subtotals {
-				// Row subtotals
-				if numRows > 1 {
-					for length := 1; length < numRows; length++ {
-						subRKey := strings.Join(rKeys[:length], " | ") + " (Total)"
-						if res.Data[subRKey] == nil {
-							res.Data[subRKey] = make(map[string]map[string]float64)
-							if !rowKeySet[subRKey] {
-								rowKeySet[subRKey] = true
-								res.Rows = append(res.Rows, subRKey)
-							}
-						}
-						if res.Data[subRKey][cKey] == nil {
-							res.Data[subRKey][cKey] = make(map[string]float64)
-						}
-						res.Data[subRKey][cKey][mKey] += val
-					}
-				}
-				// Col subtotals
-				if numCols > 1 {
-					for length := 1; length < numCols; length++ {
-						subCKey := strings.Join(cKeys[:length], " | ") + " (Total)"
-						if res.Data[rKey][subCKey] == nil {
-							res.Data[rKey][subCKey] = make(map[string]float64)
-							if !colKeySet[subCKey] {
-								colKeySet[subCKey] = true
-								res.Cols = append(res.Cols, subCKey)
-							}
-						}
-						res.Data[rKey][subCKey][mKey] += val
-					}
-				}
-			}
-		}
-	}
-
-	return res, nil
+	return query, string(configJSON), resMeasures, nil
 }
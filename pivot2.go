@@ -1,6 +1,7 @@
 package datagrid
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sort"
@@ -73,6 +74,23 @@ type Pivot2Row struct {
 	RecordFields   map[string]string      // first record's column values (for drilldown param resolution)
 }
 
+// Pivot2DataContext builds the pivot2 tree from the rows matching the request's filters
+// and search (see FetchRecordsContext). A nil cfg uses the catalog's datagrid.pivot2.
+func (h *Handler) Pivot2DataContext(ctx context.Context, p RequestParams, cfg *Pivot2Config) (*Pivot2Result, error) {
+	if cfg == nil {
+		cfg = h.Config.Pivot2
+	}
+	if cfg != nil && len(cfg.Levels) > 0 {
+		// Smart-filter conditions on measures select top-level groups
+		p.measures = &measureScope{values: cfg.Values, groupBy: cfg.Levels[0].Column}
+	}
+	records, err := h.FetchRecordsContext(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	return Pivot2Data(records, cfg), nil
+}
+
 // Pivot2Data builds a hierarchical tree from flat records.
 // Records should be pre-fetched detail-level rows (after param substitution).
 func Pivot2Data(records []map[string]interface{}, cfg *Pivot2Config) *Pivot2Result {
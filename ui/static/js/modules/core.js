@@ -44,7 +44,7 @@ window.initDatagrid = function () {
 
     // Sorting Handler
     $(document).off('click.dg-sort').on('click.dg-sort', '.datagrid-table th.sortable', function (e) {
-        if ($(e.target).hasClass('resizer')) return;
+        if ($(e.target).hasClass('resizer') || $(e.target).hasClass('dg-column-search')) return;
         if (e.shiftKey) {
             const colClass = getColClass($(this));
             $(`.${escapeClass(colClass)}`).addClass('hidden-col');
@@ -116,8 +116,21 @@ window.initDatagrid = function () {
         }
     });
 
+    // Keyset pagination: follow the cursor tokens of the current page
+    const followCursor = (cursor) => {
+        if (!cursor) return;
+        $('#cursor-input').val(cursor);
+        triggerPagination();
+    };
+
+    $(document).on('click', '.dg-cursor-btn', function () {
+        followCursor($(this).attr('data-cursor'));
+    });
+
     // Pagination Click Listeners
     $(document).on('click', '#prev-page-btn', () => {
+        const $meta = $('#pagination-metadata');
+        if ($meta.data('keyset')) return followCursor($meta.attr('data-prev-cursor'));
         const offset = parseInt($('#offset-input').val()) || 0;
         const limit = parseInt($('#limit-input').val()) || 20;
         if (offset > 0) {
@@ -127,10 +140,12 @@ window.initDatagrid = function () {
     });
 
     $(document).on('click', '#next-page-btn', () => {
+        const $meta = $('#pagination-metadata');
+        if ($meta.data('keyset')) return followCursor($meta.attr('data-next-cursor'));
         const offset = parseInt($('#offset-input').val()) || 0;
         const limit = parseInt($('#limit-input').val()) || 20;
         const total = parseInt($('#pagination-metadata').data('total-count')) || 0;
-        if (offset + limit < total) {
+        if (offset + limit < total || $('#pagination-metadata').data('count-more')) {
             $('#offset-input').val(offset + limit);
             triggerPagination();
         }
@@ -156,10 +171,17 @@ $(document).ready(() => {
 });
 
 // HTMX compatibility
+// Column search box being typed in, refocused once the table is swapped
+let activeColumnSearch = null;
+
 document.body.addEventListener('htmx:configRequest', function (evt) {
     if (evt.detail.parameters && currentSort.length > 0) {
         evt.detail.parameters['sort'] = currentSort.map(s => `${s.field}:${s.dir}`).join(',');
     }
+    if (evt.detail.elt && $(evt.detail.elt).hasClass('dg-column-search')) {
+        evt.detail.parameters['offset'] = 0;
+        activeColumnSearch = evt.detail.elt.name;
+    }
 });
 
 document.body.addEventListener('htmx:afterSwap', function (evt) {
@@ -170,8 +192,28 @@ document.body.addEventListener('htmx:afterSwap', function (evt) {
         if ($meta.length) {
             const limit = $meta.data('limit'), offset = $meta.data('offset'), total = $meta.data('total-count');
             $('#limit-input').val(limit); $('#offset-input').val(offset); $('#page-size-btn').text(limit);
-            $('#prev-page-btn').prop('disabled', offset <= 0);
-            $('#next-page-btn').prop('disabled', offset + limit >= total);
+            if ($meta.data('keyset')) {
+                $('#prev-page-btn').prop('disabled', !$meta.attr('data-prev-cursor'));
+                $('#next-page-btn').prop('disabled', !$meta.attr('data-next-cursor'));
+            } else {
+                $('#prev-page-btn').prop('disabled', offset <= 0);
+                // Estimates may be off either way: let the user page on while pages come back full
+                const approx = $meta.data('count-mode') === 'estimate';
+                const full = $meta.data('rows') >= limit;
+                $('#next-page-btn').prop('disabled', !$meta.data('count-more') && offset + limit >= total && !(approx && full));
+            }
+            $('#dg-count-info').text($meta.attr('data-count-label') || '');
+            applyFacets($meta.attr('data-facets'));
+            // A cursor is only valid for the navigation that used it
+            $('#cursor-input').val('');
+        }
+        if (activeColumnSearch) {
+            const input = document.querySelector(`.dg-column-search[name="${CSS.escape(activeColumnSearch)}"]`);
+            if (input) {
+                input.focus();
+                input.setSelectionRange(input.value.length, input.value.length);
+            }
+            activeColumnSearch = null;
         }
         applySettingsToTable();
         applyRowStyles();
@@ -19,6 +19,11 @@ window.dgCheckboxFilterUpdate = function (checkbox, field) {
     syncFilterForm(field, getValuesFromGroup(field));
 };
 
+window.dgRangeFilterChange = function (input) {
+    const key = input.getAttribute('data-filter');
+    syncFilterForm(key, input.value ? [input.value] : []);
+};
+
 function getValuesFromGroup(field) {
     // Check toggle group
     const $toggleGroup = $(`.dg-toggle-group[data-field="${field}"]`);
@@ -76,6 +81,28 @@ $(document).on('htmx:load', function () {
     $('.dg-toggle-btn').addClass('active');
 });
 
+// Facet counts (datagrid.facets): show the rows each filter value would match and grey
+// out the values that match none under the other filters
+window.applyFacets = function (json) {
+    if (!json) return;
+    let facets;
+    try { facets = JSON.parse(json); } catch (e) { return; }
+    Object.keys(facets).forEach(field => {
+        const counts = {};
+        (facets[field] || []).forEach(f => { counts[f.value] = f; });
+        const $items = $(`.dg-toggle-group[data-field="${field}"] .dg-toggle-btn, .dg-dropdown[data-field="${field}"] .dg-dropdown-item`);
+        $items.each(function () {
+            const $item = $(this);
+            const value = $item.is('.dg-toggle-btn') ? $item.attr('data-value') : $item.find('input').val();
+            const f = counts[value] || { count: 0, empty: true };
+            let $count = $item.find('.dg-facet-count');
+            if (!$count.length) $count = $('<span class="dg-facet-count"></span>').appendTo($item);
+            $count.text(f.count.toLocaleString());
+            $item.toggleClass('dg-facet-empty', !!f.empty);
+        });
+    });
+};
+
 window.triggerPagination = function () {
     htmx.trigger('#datagrid-filter-form', 'submit');
 };
@@ -145,7 +145,7 @@ window.expandJSONKeys = function () {
 let draggedColClass = null;
 
 $(document).on('dragstart', '.datagrid-table th', function (e) {
-    if ($(e.target).hasClass('resizer')) return;
+    if ($(e.target).hasClass('resizer') || $(e.target).hasClass('dg-column-search')) return;
     draggedColClass = getColClass($(this));
     e.originalEvent.dataTransfer.setData('text/plain', draggedColClass);
     $(this).addClass('dg-dragging');
@@ -189,7 +189,7 @@ $(document).on('drop', '.datagrid-table th', function (e) {
     }
 
     // Now move all TD cells
-    $table.find('tbody tr').each(function () {
+    $table.find('tbody tr, tfoot tr').each(function () {
         const $tr = $(this);
         const $draggedTd = $tr.find(`.${escapeClass(draggedColClass)}`);
         const $targetTd = $tr.find(`.${escapeClass(targetClass)}`);
@@ -203,3 +203,94 @@ $(document).on('drop', '.datagrid-table th', function (e) {
     saveSettings();
     initColumnChooser();
 });
+
+// --- Inline Cell Editing (Handler.CellEndpoint) ---
+// Double-click an editable cell, Enter or blur saves, Escape cancels. The server answers
+// with the re-rendered <td> and the row's new version; 409 means someone else changed
+// the row meanwhile and the cell then shows their value.
+$(document).on('dblclick', '.datagrid-table[data-cell-endpoint] tbody td', function (e) {
+    const $td = $(this);
+    const $table = $td.closest('table');
+    const $tr = $td.closest('tr');
+    const $th = $table.find('thead th').eq($td.index());
+    if (!$th.data('editable') || !$tr.attr('data-key') || $td.find('.dg-cell-editor').length) return;
+    if ($(e.target).closest('a, button').length) return;
+
+    const field = $th.data('field');
+    const type = String($th.data('type') || '');
+    let record = $tr.data('json');
+    if (typeof record === 'string') try { record = JSON.parse(record); } catch (err) { record = {}; }
+    const current = record && record[field] !== null && record[field] !== undefined ? record[field] : '';
+
+    let $editor;
+    const lov = $th.data('lov');
+    if (lov && lov.length) {
+        $editor = $('<select class="dg-cell-editor"><option value=""></option></select>');
+        lov.forEach(item => $editor.append($('<option>').val(String(item.value)).text(item.label || String(item.value))));
+    } else if (type === 'bool' || type === 'boolean' || type === 'int_bool') {
+        $editor = $('<select class="dg-cell-editor"><option value=""></option><option value="true">true</option><option value="false">false</option></select>');
+    } else {
+        $editor = $('<input type="text" class="dg-cell-editor">');
+        if (type.includes('int') || type.startsWith('numeric') || type === 'double') $editor.attr('inputmode', 'decimal');
+        if (type === 'date') $editor.attr('type', 'date');
+    }
+    let initial = typeof current === 'object' ? JSON.stringify(current) : String(current);
+    if (type === 'int_bool' && initial !== '') initial = (initial === '1' || initial === 'true') ? 'true' : 'false';
+    $editor.val(initial);
+
+    const original = $td.html();
+    $td.addClass('dg-cell-editing').removeClass('dg-cell-error dg-cell-conflict').empty().append($editor);
+    $editor.trigger('focus');
+
+    let done = false;
+    const cancel = () => {
+        done = true;
+        $td.removeClass('dg-cell-editing').html(original);
+    };
+    const save = () => {
+        if (done) return;
+        done = true;
+        const value = $editor.val();
+        if (value === initial) return cancel();
+
+        const body = new URLSearchParams(JSON.parse($tr.attr('data-key')));
+        body.set('_field', field);
+        body.set('_value', value);
+        body.set('_version', $tr.attr('data-version') || '');
+        $td.addClass('dg-cell-saving');
+        fetch($table.attr('data-cell-endpoint'), { method: 'PATCH', body })
+            .then(resp => resp.text().then(html => ({ resp, html })))
+            .then(({ resp, html }) => {
+                if (resp.ok || resp.status === 409) {
+                    const $new = $(html.trim()).filter('td').first();
+                    $new.attr('class', $td.attr('class')).removeClass('dg-cell-editing dg-cell-saving');
+                    const version = resp.headers.get('X-Row-Version');
+                    if (version) $tr.attr('data-version', version);
+
+                    let stored = value;
+                    if (resp.status === 409) {
+                        const raw = resp.headers.get('X-Current-Value');
+                        try { stored = raw ? JSON.parse(decodeURIComponent(raw)) : null; } catch (err) { }
+                        $new.addClass('dg-cell-conflict').attr('title', 'Changed by someone else meanwhile; this is their value');
+                    }
+                    record[field] = stored;
+                    $tr.attr('data-json', JSON.stringify(record)).removeData('json');
+                    $td.replaceWith($new);
+                    return;
+                }
+                cancel();
+                $td.addClass('dg-cell-error').attr('title', html.trim());
+            })
+            .catch(() => {
+                cancel();
+                $td.addClass('dg-cell-error');
+            });
+    };
+
+    $editor.on('keydown', ev => {
+        if (ev.key === 'Enter') { ev.preventDefault(); save(); }
+        else if (ev.key === 'Escape') { ev.preventDefault(); cancel(); }
+    });
+    $editor.on('blur', save);
+    $editor.on('click dblclick', ev => ev.stopPropagation());
+});
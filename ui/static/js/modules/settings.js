@@ -73,7 +73,7 @@ window.applySettingsToTable = function () {
                 if ($th.length) $thead.append($th);
             });
 
-            $table.find('tbody tr').each(function () {
+            $table.find('tbody tr, tfoot tr').each(function () {
                 const $tr = $(this);
                 s.columnOrder.forEach(cls => {
                     const $td = $tr.find(`.${escapeClass(cls)}`);